@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// abSlowdowns is how many of the queries B slowed down most are listed.
+const abSlowdowns = 5
+
+// runAB runs queries against a and b at the same time, each with batchSize
+// workers, so both hosts see the same load under the same conditions. It
+// returns the counts and results of a, as the run's own, and the results of
+// b.
+func runAB(ctx context.Context, a, b *BatchSearcher, indexNames []string, queries []BatchQuery, batchSize int) (int64, int64, []QueryResult, []QueryResult) {
+	var (
+		wg       sync.WaitGroup
+		resultsB []QueryResult
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _, resultsB = b.RunBatchSearch(ctx, indexNames, queries, batchSize)
+	}()
+	successCount, failureCount, results := a.RunBatchSearch(ctx, indexNames, queries, batchSize)
+	wg.Wait()
+	return successCount, failureCount, results, resultsB
+}
+
+// printABComparison prints the latency percentiles of hosts A and B side by
+// side, then the per-query latency delta of B over A for the queries that
+// succeeded on both, with those B slowed down most.
+func printABComparison(hostA, hostB string, resultsA, resultsB []QueryResult) {
+	statsA, okA := computeLatencyStats(successLatencies(resultsA))
+	statsB, okB := computeLatencyStats(successLatencies(resultsB))
+	fmt.Printf("A/B comparison (A: %s, B: %s):\n", hostA, hostB)
+	if !okA || !okB {
+		fmt.Println("  n/a: no query succeeded on one of the hosts")
+		return
+	}
+	row := func(label string, a, b time.Duration) {
+		fmt.Printf("  %-10s %14v %14v %15s\n", label, a.Round(time.Microsecond), b.Round(time.Microsecond), signedDuration(b-a))
+	}
+	fmt.Printf("  %-10s %14s %14s %15s\n", "", "A", "B", "B - A")
+	fmt.Printf("  %-10s %14d %14d %+15d\n", "succeeded", statsA.Count, statsB.Count, statsB.Count-statsA.Count)
+	row("min", statsA.Min, statsB.Min)
+	row("mean", statsA.Mean, statsB.Mean)
+	row("p50", statsA.P50, statsB.P50)
+	row("p95", statsA.P95, statsB.P95)
+	row("p99", statsA.P99, statsB.P99)
+	row("max", statsA.Max, statsB.Max)
+
+	type pair struct {
+		a, b QueryResult
+	}
+	byIndex := make(map[int]QueryResult, len(resultsB))
+	for _, result := range resultsB {
+		if result.Error == nil && !result.Skipped {
+			byIndex[result.QueryIndex] = result
+		}
+	}
+	var (
+		pairs  []pair
+		deltas []time.Duration
+		faster int
+	)
+	for _, a := range resultsA {
+		b, ok := byIndex[a.QueryIndex]
+		if a.Error != nil || a.Skipped || !ok {
+			continue
+		}
+		pairs = append(pairs, pair{a, b})
+		deltas = append(deltas, b.Latency-a.Latency)
+		if b.Latency < a.Latency {
+			faster++
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i] < deltas[j] })
+	delta, _ := computeLatencyStats(deltas)
+	fmt.Printf("Per-query delta (B - A) over %d queries that succeeded on both: mean %s, p50 %s, p95 %s; B faster for %d (%.1f%%)\n",
+		len(pairs), signedDuration(delta.Mean), signedDuration(delta.P50), signedDuration(delta.P95),
+		faster, 100*float64(faster)/float64(len(pairs)))
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].b.Latency-pairs[i].a.Latency > pairs[j].b.Latency-pairs[j].a.Latency
+	})
+	slower := len(pairs) - faster
+	if slower == 0 {
+		return
+	}
+	fmt.Println("Largest slowdowns on B:")
+	for _, p := range pairs[:min(abSlowdowns, slower)] {
+		if p.b.Latency == p.a.Latency {
+			break
+		}
+		fmt.Printf("  query %d (%s): A %v, B %v (%s)\n", p.a.QueryIndex, p.a.Type,
+			p.a.Latency.Round(time.Microsecond), p.b.Latency.Round(time.Microsecond), signedDuration(p.b.Latency-p.a.Latency))
+	}
+}
+
+// signedDuration formats d rounded to the microsecond, with a + sign when it
+// is positive.
+func signedDuration(d time.Duration) string {
+	d = d.Round(time.Microsecond)
+	if d > 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
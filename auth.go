@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Authentication modes accepted by -auth.
+const (
+	authBasic  = "basic"
+	authBearer = "bearer"
+)
+
+// Environment variables read for credentials not given on the command line.
+const (
+	envUser = "QUERYRUNNER_USER"
+	envPass = "QUERYRUNNER_PASS"
+)
+
+// credentialFromEnv returns the environment variable env in place of value
+// when flagName was not set on the command line, so that secrets can be kept
+// out of shell history and process listings. Explicit flags take precedence;
+// the environment overrides -config.
+func credentialFromEnv(flagName, value, env string) string {
+	if fromEnv, ok := os.LookupEnv(env); ok && (!flagSet(flagName) || configFlags[flagName]) {
+		return fromEnv
+	}
+	return value
+}
+
+// flagSet reports whether the named flag was set, on the command line or by
+// -config.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// authenticator adds credentials to every search request.
+type authenticator interface {
+	authenticate(req *http.Request)
+}
+
+// basicAuth sends a username and password, as Couchbase Server expects.
+type basicAuth struct {
+	header string
+}
+
+func newBasicAuth(username, password string) basicAuth {
+	return basicAuth{header: "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))}
+}
+
+func (a basicAuth) authenticate(req *http.Request) {
+	req.Header.Add("Authorization", a.header)
+}
+
+// bearerAuth sends a token, such as a Capella API key.
+type bearerAuth struct {
+	token string
+}
+
+func (a bearerAuth) authenticate(req *http.Request) {
+	req.Header.Add("Authorization", "Bearer "+a.token)
+}
+
+// newAuthenticator returns the authenticator for the given -auth mode.
+func newAuthenticator(mode, username, password, token string) (authenticator, error) {
+	switch mode {
+	case authBasic:
+		return newBasicAuth(username, password), nil
+	case authBearer:
+		if token == "" {
+			return nil, errors.New("bearer authentication requires -token")
+		}
+		return bearerAuth{token: token}, nil
+	}
+	return nil, fmt.Errorf("unknown authentication mode %q (want %s or %s)", mode, authBasic, authBearer)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxBaselineDiffs bounds how many diverged queries are described one by one.
+const maxBaselineDiffs = 20
+
+// baselineResult is what a baseline results file recorded for one query.
+type baselineResult struct {
+	Success   bool
+	TotalHits int
+	HitIDs    []string
+}
+
+// loadBaseline reads a results file written by an earlier run, keyed by
+// QueryIndex, to compare this run's results against.
+func loadBaseline(path string) (map[int]baselineResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	// Errors are written as {}, which cannot be read back into an error, so
+	// only the fields compared are decoded.
+	var entries []struct {
+		Query struct {
+			QueryIndex int
+			Result     *SearchResult
+			Skipped    bool
+		} `json:"query_result"`
+		Success bool `json:"success"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %v", path, err)
+	}
+
+	baseline := make(map[int]baselineResult, len(entries))
+	for i, entry := range entries {
+		if entry.Query.Skipped {
+			continue
+		}
+		result := baselineResult{Success: entry.Success}
+		if entry.Success {
+			if entry.Query.Result == nil {
+				return nil, fmt.Errorf("entry %d in %s has no search result to compare; was it written with -transform?", i, path)
+			}
+			result.TotalHits = entry.Query.Result.Total
+			result.HitIDs = hitIDs(entry.Query.Result)
+		}
+		baseline[entry.Query.QueryIndex] = result
+	}
+	return baseline, nil
+}
+
+func hitIDs(result *SearchResult) []string {
+	ids := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// baselineDiff describes how a query's result differs from the baseline, or
+// returns "" if it does not.
+func baselineDiff(want baselineResult, got QueryResult) string {
+	switch {
+	case want.Success && got.Error != nil:
+		return fmt.Sprintf("succeeded in the baseline, now failed: %v", got.Error)
+	case !want.Success && got.Error == nil:
+		return "failed in the baseline, now succeeded"
+	case !want.Success:
+		return ""
+	}
+
+	var diffs []string
+	if got.Result.Total != want.TotalHits {
+		diffs = append(diffs, fmt.Sprintf("total_hits %d -> %d", want.TotalHits, got.Result.Total))
+	}
+	if ids := hitIDs(got.Result); strings.Join(ids, ",") != strings.Join(want.HitIDs, ",") {
+		diffs = append(diffs, fmt.Sprintf("hit IDs [%s] -> [%s]", strings.Join(want.HitIDs, " "), strings.Join(ids, " ")))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// printBaselineComparison compares every query sent against the baseline
+// result with the same QueryIndex and prints the queries that diverged. It
+// reports whether none did.
+func printBaselineComparison(path string, baseline map[int]baselineResult, results []QueryResult) bool {
+	var (
+		compared, missing int
+		diverged          []int
+		diffs             = make(map[int]string)
+	)
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		want, ok := baseline[result.QueryIndex]
+		if !ok {
+			missing++
+			continue
+		}
+		compared++
+		if diff := baselineDiff(want, result); diff != "" {
+			diverged = append(diverged, result.QueryIndex)
+			diffs[result.QueryIndex] = diff
+		}
+	}
+	sort.Ints(diverged)
+
+	fmt.Printf("Baseline %s: %d of %d compared queries diverged\n", path, len(diverged), compared)
+	if missing > 0 {
+		fmt.Printf("  %d queries are not in the baseline\n", missing)
+	}
+	for i, index := range diverged {
+		if i == maxBaselineDiffs {
+			fmt.Printf("  ... and %d more\n", len(diverged)-maxBaselineDiffs)
+			break
+		}
+		fmt.Printf("  query %d: %s\n", index, diffs[index])
+	}
+	return len(diverged) == 0
+}
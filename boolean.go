@@ -0,0 +1,53 @@
+package main
+
+import "math/rand"
+
+// defaultBoolClauses is how many clauses a generated boolean query has.
+const defaultBoolClauses = 3
+
+// booleanQuery builds a boolean query whose clauses, each a location or
+// relationship search from loc and then random locations, are spread at
+// random across must, should and must_not. The first clause always goes to
+// must or should so the query matches something.
+func (o GeneratorOptions) booleanQuery(loc Root, locations []Root, rng *rand.Rand) BooleanQuery {
+	clauses := o.BoolClauses
+	if clauses <= 0 {
+		clauses = defaultBoolClauses
+	}
+
+	var must, should, mustNot []interface{}
+	for i := 0; i < clauses; i++ {
+		if i > 0 {
+			loc = locations[rng.Intn(len(locations))]
+		}
+		var clause interface{} = relationshipClause(loc)
+		if rng.Intn(2) == 0 {
+			clause = o.locationClause(loc, rng)
+		}
+
+		lists := 3
+		if i == 0 {
+			lists = 2
+		}
+		switch rng.Intn(lists) {
+		case 0:
+			must = append(must, clause)
+		case 1:
+			should = append(should, clause)
+		default:
+			mustNot = append(mustNot, clause)
+		}
+	}
+
+	query := BooleanQuery{}
+	if must != nil {
+		query.Query.Must = &ConjunctClauses{Conjuncts: must}
+	}
+	if should != nil {
+		query.Query.Should = &DisjunctClauses{Disjuncts: should, Min: 1}
+	}
+	if mustNot != nil {
+		query.Query.MustNot = &DisjunctClauses{Disjuncts: mustNot}
+	}
+	return query
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerWindow is how many of the most recent queries the breaker
+	// measures the error rate over.
+	breakerWindow = 50
+	// breakerProbes is how many queries are let through after a cooldown to
+	// check whether the server has recovered.
+	breakerProbes = 5
+)
+
+// Circuit breaker states.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker pauses dispatch while the server is failing. Once the error
+// rate over the last breakerWindow queries exceeds threshold it opens and
+// dispatches nothing for cooldown, then lets breakerProbes queries through:
+// if they all succeed dispatch resumes, and otherwise it opens again. A nil
+// breaker never pauses.
+type circuitBreaker struct {
+	threshold float64
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     int
+	window    []bool
+	next      int
+	filled    bool
+	failures  int
+	openUntil time.Time
+	// probesLeft is how many probes may still be dispatched, and probesDone
+	// how many have completed, while half-open.
+	probesLeft int
+	probesDone int
+	// changed is closed and replaced whenever the state changes, to wake
+	// dispatch waiting for half-open probes to complete.
+	changed chan struct{}
+	trips   int
+	paused  time.Duration
+}
+
+func newCircuitBreaker(threshold float64, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		window:    make([]bool, breakerWindow),
+		changed:   make(chan struct{}),
+	}
+}
+
+// wait blocks while the breaker is open, or half-open with every probe
+// dispatched, returning false if ctx is cancelled or stop is closed first.
+func (b *circuitBreaker) wait(ctx context.Context, stop <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		b.mu.Lock()
+		var (
+			timer   *time.Timer
+			expired <-chan time.Time
+			changed <-chan struct{}
+		)
+		switch b.state {
+		case breakerClosed:
+			b.mu.Unlock()
+			return true
+		case breakerOpen:
+			if remaining := time.Until(b.openUntil); remaining > 0 {
+				timer = time.NewTimer(remaining)
+				expired = timer.C
+				break
+			}
+			fmt.Printf("Circuit breaker half-open: probing with %d queries\n", breakerProbes)
+			b.setState(breakerHalfOpen)
+			b.probesLeft, b.probesDone = breakerProbes, 0
+			b.mu.Unlock()
+			continue
+		case breakerHalfOpen:
+			if b.probesLeft > 0 {
+				b.probesLeft--
+				b.mu.Unlock()
+				return true
+			}
+			changed = b.changed
+		}
+		b.mu.Unlock()
+
+		var ok bool
+		select {
+		case <-expired:
+			ok = true
+		case <-changed:
+			ok = true
+		case <-ctx.Done():
+		case <-stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !ok {
+			return false
+		}
+	}
+}
+
+// record adds a completed query to the breaker. It is meant to be called
+// from SearcherOptions.OnResult.
+func (b *circuitBreaker) record(result QueryResult) {
+	if result.Skipped {
+		return
+	}
+	failed := result.Error != nil
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerClosed:
+		if b.filled && b.window[b.next] {
+			b.failures--
+		}
+		b.window[b.next] = failed
+		if failed {
+			b.failures++
+		}
+		b.next = (b.next + 1) % len(b.window)
+		if b.next == 0 {
+			b.filled = true
+		}
+		if b.filled && float64(b.failures)/float64(len(b.window)) > b.threshold {
+			fmt.Printf("Circuit breaker open: %d of the last %d queries failed; pausing dispatch for %v\n", b.failures, len(b.window), b.cooldown)
+			b.trip()
+		}
+	case breakerHalfOpen:
+		// Queries dispatched before the breaker opened may still complete
+		// here; they are counted as probes too.
+		b.probesDone++
+		switch {
+		case failed:
+			fmt.Printf("Circuit breaker open: probe failed; pausing dispatch for %v\n", b.cooldown)
+			b.trip()
+		case b.probesDone >= breakerProbes:
+			fmt.Println("Circuit breaker closed: probes succeeded; resuming dispatch")
+			b.window = make([]bool, breakerWindow)
+			b.next, b.filled, b.failures = 0, false, 0
+			b.setState(breakerClosed)
+		}
+	}
+}
+
+// trip opens the breaker for a cooldown. b.mu must be held.
+func (b *circuitBreaker) trip() {
+	b.trips++
+	b.paused += b.cooldown
+	b.openUntil = time.Now().Add(b.cooldown)
+	b.setState(breakerOpen)
+}
+
+// setState moves the breaker to state and wakes any waiting dispatch. b.mu
+// must be held.
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// printReport prints how often the breaker opened, if it did.
+func (b *circuitBreaker) printReport() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.trips > 0 {
+		fmt.Printf("Circuit breaker opened %d times, pausing dispatch for %v in total\n", b.trips, b.paused)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// timeBucket summarizes the queries that completed within one fixed interval
+// of a run, so that a burst of failures, e.g. during a failover, stands out
+// from an otherwise healthy aggregate.
+type timeBucket struct {
+	StartSeconds float64 `json:"start_seconds"`
+	Queries      int     `json:"queries"`
+	Failures     int     `json:"failures"`
+	ErrorRate    float64 `json:"error_rate"`
+	// Latency is omitted when no query in the bucket succeeded.
+	Latency *latencySummary `json:"latency_ms,omitempty"`
+}
+
+// timeBuckets splits the results of a run that began at start into
+// consecutive intervals of width by completion time, up to the last result.
+// Intervals in which nothing completed are kept, since a stall is worth
+// seeing too. Skipped queries are left out.
+func timeBuckets(results []QueryResult, start time.Time, width time.Duration) []timeBucket {
+	if width <= 0 {
+		return nil
+	}
+	var (
+		queries   [][]QueryResult
+		latencies [][]time.Duration
+	)
+	for _, result := range results {
+		if result.Skipped || result.CompletedAt.IsZero() {
+			continue
+		}
+		i := 0
+		if offset := result.CompletedAt.Sub(start); offset > 0 {
+			i = int(offset / width)
+		}
+		for len(queries) <= i {
+			queries = append(queries, nil)
+			latencies = append(latencies, nil)
+		}
+		queries[i] = append(queries[i], result)
+		if result.Error == nil {
+			latencies[i] = append(latencies[i], result.Latency)
+		}
+	}
+
+	buckets := make([]timeBucket, len(queries))
+	for i := range buckets {
+		sort.Slice(latencies[i], func(a, b int) bool { return latencies[i][a] < latencies[i][b] })
+		bucket := timeBucket{
+			StartSeconds: (time.Duration(i) * width).Seconds(),
+			Queries:      len(queries[i]),
+			Failures:     len(queries[i]) - len(latencies[i]),
+			Latency:      newLatencySummary(latencies[i]),
+		}
+		if bucket.Queries > 0 {
+			bucket.ErrorRate = float64(bucket.Failures) / float64(bucket.Queries)
+		}
+		buckets[i] = bucket
+	}
+	return buckets
+}
+
+// printTimeBuckets prints the query count, error rate and latency of each
+// interval, if the run spanned more than one.
+func printTimeBuckets(buckets []timeBucket, width time.Duration) {
+	if len(buckets) < 2 {
+		return
+	}
+	fmt.Printf("By %v interval:\n", width)
+	for i, bucket := range buckets {
+		from, to := time.Duration(i)*width, time.Duration(i+1)*width
+		if bucket.Latency == nil {
+			fmt.Printf("  %v-%v: %d queries, %.1f%% failed, latency n/a\n", from, to, bucket.Queries, 100*bucket.ErrorRate)
+			continue
+		}
+		fmt.Printf("  %v-%v: %d queries, %.1f%% failed, mean %.1fms, p95 %.1fms\n",
+			from, to, bucket.Queries, 100*bucket.ErrorRate, bucket.Latency.Mean, bucket.Latency.P95)
+	}
+}
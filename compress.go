@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// gzipBytes returns data gzip-compressed, for -compress request bodies.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBody returns the response body as received on the wire and decoded.
+// performSearch asks for gzip itself, so the transport leaves gzipped
+// responses to it; counting the raw bytes shows what compression saved.
+func decodeBody(resp *http.Response) (raw, body []byte, err error) {
+	raw, err = io.ReadAll(resp.Body)
+	if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") || len(raw) == 0 {
+		return raw, raw, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return raw, nil, fmt.Errorf("invalid gzip response: %w", err)
+	}
+	body, err = io.ReadAll(zr)
+	if err != nil {
+		return raw, nil, fmt.Errorf("invalid gzip response: %w", err)
+	}
+	return raw, body, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFlags records the flags whose values came from -config rather than
+// the command line, so that environment variables can still override them.
+var configFlags = make(map[string]bool)
+
+// applyConfig sets every flag named in the YAML file at path that was not
+// set on the command line. The file is a mapping of flag names, without the
+// leading dash, to values; repeatable flags such as header take a list.
+// Precedence is defaults < config file < environment < command line.
+func applyConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("config %s: want a mapping of flag names to values", path)
+	}
+
+	onCommandLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		name := key.Value
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("config %s, line %d: unknown option %q", path, key.Line, name)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+
+		values := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			values = value.Content
+		}
+		for _, v := range values {
+			if v.Kind != yaml.ScalarNode {
+				return fmt.Errorf("config %s, line %d: %s must be a value or a list of values", path, v.Line, name)
+			}
+			if err := flag.Set(name, v.Value); err != nil {
+				return fmt.Errorf("config %s, line %d: invalid %s: %v", path, v.Line, name, err)
+			}
+		}
+		configFlags[name] = true
+	}
+	return nil
+}
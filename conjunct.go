@@ -0,0 +1,74 @@
+package main
+
+import "math/rand"
+
+// defaultConjuncts is how many clauses a generated conjunct query has: a
+// location and a relationship search of the same location.
+const defaultConjuncts = 2
+
+func (o GeneratorOptions) conjuncts() int {
+	if o.Conjuncts > 0 {
+		return o.Conjuncts
+	}
+	return defaultConjuncts
+}
+
+// conjunctQuery builds a conjunct query of alternating location and
+// relationship searches, a pair per location: first loc, then further
+// locations drawn at random without repeats. locations must hold enough
+// locations for the pairs, as checked by GeneratorOptions.locations.
+func (o GeneratorOptions) conjunctQuery(loc Root, locations []Root, rng *rand.Rand) ConjunctQuery {
+	n := o.conjuncts()
+	clauses := make([]interface{}, 0, n)
+	used := map[locationKey]bool{keyOf(loc): true}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			if i > 0 {
+				loc = pickUnused(locations, used, rng)
+			}
+			clauses = append(clauses, o.locationClause(loc, rng))
+		} else {
+			clauses = append(clauses, relationshipClause(loc))
+		}
+	}
+
+	query := ConjunctQuery{}
+	query.Query.Conjuncts = clauses
+	return query
+}
+
+// locationKey tells apart locations that would give different clauses.
+type locationKey struct {
+	point        geoPoint
+	relationship string
+}
+
+func keyOf(loc Root) locationKey {
+	return locationKey{pointOf(loc), loc.Bklctrcb.Relationship}
+}
+
+// pickUnused draws a location unlike those drawn before, marking it used.
+func pickUnused(locations []Root, used map[locationKey]bool, rng *rand.Rand) Root {
+	for {
+		loc := locations[rng.Intn(len(locations))]
+		if key := keyOf(loc); !used[key] {
+			used[key] = true
+			return loc
+		}
+	}
+}
+
+// conjunctLocations is how many distinct locations a conjunct query of n
+// clauses draws on.
+func conjunctLocations(n int) int {
+	return (n + 1) / 2
+}
+
+// distinctLocations counts the locations that would give different clauses.
+func distinctLocations(locations []Root) int {
+	seen := make(map[locationKey]bool, len(locations))
+	for _, loc := range locations {
+		seen[keyOf(loc)] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// typeControl lets query types be disabled and re-enabled while a run is in
+// progress. Queries of a disabled type are skipped instead of dispatched.
+type typeControl struct {
+	mu       sync.Mutex
+	disabled map[string]time.Time
+	// history keeps the first time each type was disabled, for the report.
+	history map[string]time.Time
+	skipped map[string]int64
+}
+
+func newTypeControl() *typeControl {
+	return &typeControl{
+		disabled: make(map[string]time.Time),
+		history:  make(map[string]time.Time),
+		skipped:  make(map[string]int64),
+	}
+}
+
+func (c *typeControl) disable(queryType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.disabled[queryType]; ok {
+		return
+	}
+	now := time.Now()
+	c.disabled[queryType] = now
+	if _, ok := c.history[queryType]; !ok {
+		c.history[queryType] = now
+	}
+	slog.Info("disabled dispatch of query type", "type", queryType)
+}
+
+func (c *typeControl) enable(queryType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.disabled[queryType]; !ok {
+		return
+	}
+	delete(c.disabled, queryType)
+	slog.Info("re-enabled dispatch of query type", "type", queryType)
+}
+
+// skip reports whether queries of queryType are currently disabled, counting
+// the query as skipped if they are.
+func (c *typeControl) skip(queryType string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.disabled[queryType]; !ok {
+		return false
+	}
+	c.skipped[queryType]++
+	return true
+}
+
+// ServeHTTP exposes the control over HTTP. NAME must be a generated query
+// type or other, so a misspelled type is rejected rather than disabling
+// nothing:
+//
+//	GET  /types                    disabled types and skip counts
+//	POST /types/disable?type=NAME  stop dispatching queries of type NAME
+//	POST /types/enable?type=NAME   resume dispatching queries of type NAME
+func (c *typeControl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/types":
+		c.mu.Lock()
+		state := struct {
+			Disabled map[string]time.Time `json:"disabled"`
+			Skipped  map[string]int64     `json:"skipped"`
+		}{c.disabled, c.skipped}
+		data, err := json.Marshal(state)
+		c.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case "/types/disable", "/types/enable":
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		queryType := r.URL.Query().Get("type")
+		if queryType == "" {
+			http.Error(w, "missing type parameter", http.StatusBadRequest)
+			return
+		}
+		if !isGeneratedType(queryType) && queryType != typeOther {
+			http.Error(w, fmt.Sprintf("unknown query type %q (want one of %s or %s)", queryType, strings.Join(generatedTypes, ", "), typeOther), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/types/disable" {
+			c.disable(queryType)
+		} else {
+			c.enable(queryType)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// printReport prints when each type was disabled and how many of its queries
+// were skipped as a result.
+func (c *typeControl) printReport() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	types := make([]string, 0, len(c.history))
+	for queryType := range c.history {
+		types = append(types, queryType)
+	}
+	sort.Strings(types)
+
+	for _, queryType := range types {
+		fmt.Printf("Disabled %s queries at %s: %d skipped\n", queryType, c.history[queryType].Format(time.TimeOnly), c.skipped[queryType])
+	}
+}
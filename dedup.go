@@ -0,0 +1,17 @@
+package main
+
+// dedupQueries returns queries with every byte-identical repeat of an
+// earlier query removed, keeping the first occurrence of each, and how many
+// were dropped. The input slice is not modified.
+func dedupQueries(queries []BatchQuery) ([]BatchQuery, int) {
+	seen := make(map[string]bool, len(queries))
+	unique := make([]BatchQuery, 0, len(queries))
+	for _, query := range queries {
+		if seen[query.Body] {
+			continue
+		}
+		seen[query.Body] = true
+		unique = append(unique, query)
+	}
+	return unique, len(queries) - len(unique)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// defaultDistance is the radius of generated location searches.
+const defaultDistance = "100mi"
+
+// distanceUnits are the distance units FTS geo queries accept.
+var distanceUnits = []string{"mm", "cm", "in", "ft", "yd", "mi", "km", "nm", "m"}
+
+// parseDistance splits a distance such as "100mi" into its value and unit.
+func parseDistance(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	for _, unit := range distanceUnits {
+		if !strings.HasSuffix(s, unit) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(s, unit), 64)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid distance %q: %v", s, err)
+		}
+		if value <= 0 {
+			return 0, "", fmt.Errorf("distance %q must be positive", s)
+		}
+		return value, unit, nil
+	}
+	return 0, "", fmt.Errorf("distance %q needs a unit (one of %s)", s, strings.Join(distanceUnits, ", "))
+}
+
+// distanceRange is a span of search radii in one unit.
+type distanceRange struct {
+	Min, Max float64
+	Unit     string
+}
+
+// parseDistanceRange parses a range such as "10mi-500mi". Both ends must use
+// the same unit.
+func parseDistanceRange(spec string) (*distanceRange, error) {
+	low, high, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("expected min-max, got %q", spec)
+	}
+	minValue, minUnit, err := parseDistance(low)
+	if err != nil {
+		return nil, err
+	}
+	maxValue, maxUnit, err := parseDistance(high)
+	if err != nil {
+		return nil, err
+	}
+	if minUnit != maxUnit {
+		return nil, fmt.Errorf("both ends of %q must use the same unit", spec)
+	}
+	if minValue > maxValue {
+		return nil, fmt.Errorf("minimum of %q is above its maximum", spec)
+	}
+	return &distanceRange{Min: minValue, Max: maxValue, Unit: minUnit}, nil
+}
+
+// distance returns the radius of the next generated location search.
+func (o GeneratorOptions) distance(rng *rand.Rand) string {
+	if r := o.DistanceRange; r != nil {
+		value := r.Min + rng.Float64()*(r.Max-r.Min)
+		return strconv.FormatFloat(value, 'f', 1, 64) + r.Unit
+	}
+	if o.Distance != "" {
+		return o.Distance
+	}
+	return defaultDistance
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// endpoint returns the URL that queries against indexName are sent to.
+func (bs *BatchSearcher) endpoint(indexName string) string {
+	return strings.NewReplacer("{host}", bs.baseURL, "{index}", indexName).Replace(bs.pathTemplate)
+}
+
+// printDryRun writes the request line to info and then every query body, one
+// per line and in dispatch order, to out, instead of sending them.
+func (bs *BatchSearcher) printDryRun(out, info io.Writer, indexNames []string, queries []BatchQuery) {
+	endpoints := make([]string, len(indexNames))
+	for i, indexName := range indexNames {
+		endpoints[i] = bs.endpoint(indexName)
+	}
+	fmt.Fprintf(info, "Dry run: %d queries would be sent as %s %s\n", len(queries), bs.method, strings.Join(endpoints, ", "))
+	for _, query := range queries {
+		fmt.Fprintln(out, query.Body)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// HTTPError is returned by performSearch for non-200 responses, so callers
+// can branch on the status code.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// Message is the error message extracted from a JSON error body, or
+	// empty if the body is not one.
+	Message string
+	// RetryAfter is the raw Retry-After header of the response, if any.
+	RetryAfter string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// errorMessage extracts the message from a JSON error body: the "error" string
+// FTS returns, a "message" string, or the "reason" of an Elasticsearch-style
+// "error" object. It returns "" if body is not JSON or has none of these.
+func errorMessage(body []byte) string {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return ""
+	}
+
+	var message string
+	if json.Unmarshal(parsed.Error, &message) == nil && message != "" {
+		return message
+	}
+	var object struct {
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(parsed.Error, &object) == nil && object.Reason != "" {
+		return object.Reason
+	}
+	return parsed.Message
+}
+
+// errorCategory buckets a query error by its cause, for failure summaries:
+// timeout, connection error, 4xx, 5xx, parse error or other, plus the
+// categories for queries refused as too large, responses with too few hits
+// and requests cancelled.
+func errorCategory(err error) string {
+	var (
+		httpErr   *HTTPError
+		netErr    net.Error
+		urlErr    *url.Error
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, errQueryTooLarge):
+		return "query too large"
+	case errors.Is(err, errTooFewHits):
+		return "too few hits"
+	case errors.As(err, &httpErr):
+		switch {
+		case httpErr.StatusCode >= 500:
+			return "5xx"
+		case httpErr.StatusCode >= 400:
+			return "4xx"
+		}
+		return fmt.Sprintf("HTTP %d", httpErr.StatusCode)
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &urlErr):
+		return "connection error"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return "parse error"
+	}
+	return "other"
+}
+
+// statusLabel names the outcome of a query by its HTTP status, or by its
+// error category if it failed without a response.
+func statusLabel(err error) string {
+	var httpErr *HTTPError
+	switch {
+	case err == nil:
+		return "200"
+	case errors.As(err, &httpErr):
+		return strconv.Itoa(httpErr.StatusCode)
+	}
+	return errorCategory(err)
+}
+
+// maxExampleLength bounds the example error printed for each category.
+const maxExampleLength = 160
+
+// printFailureSummary prints how many failed queries fell into each error
+// category, most common first, with the first error seen in each as an
+// example.
+func printFailureSummary(results []QueryResult) {
+	counts := make(map[string]int)
+	examples := make(map[string]string)
+	for _, result := range results {
+		if result.Error != nil {
+			category := errorCategory(result.Error)
+			counts[category]++
+			if _, ok := examples[category]; !ok {
+				examples[category] = result.Error.Error()
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if counts[categories[i]] != counts[categories[j]] {
+			return counts[categories[i]] > counts[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+
+	fmt.Println("Failures by category:")
+	for _, category := range categories {
+		example := examples[category]
+		if len(example) > maxExampleLength {
+			example = example[:maxExampleLength] + "..."
+		}
+		fmt.Printf("  %s: %d (e.g. %s)\n", category, counts[category], example)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// runEstimate is a rough forecast of what a run will cost.
+type runEstimate struct {
+	Requests int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// estimateLoad describes how a run sends its requests, for estimateRun.
+type estimateLoad struct {
+	// Concurrency is the number of requests in flight per host.
+	Concurrency int
+	// Latency is assumed for every request.
+	Latency time.Duration
+	// RPS caps the rate per host; zero is unlimited.
+	RPS float64
+	// Think is the pause of each worker between requests.
+	Think thinkTime
+	// Hosts is the number of hosts every query is sent to, 2 with -host-b.
+	Hosts int
+}
+
+// estimateRun forecasts running queries repeats times on every host. Each
+// host takes as long as the slower of its workers, spending latency plus the
+// mean think time per request, and its rate limit.
+func estimateRun(queries []BatchQuery, repeats int, load estimateLoad) runEstimate {
+	var bytes int64
+	for _, query := range queries {
+		bytes += int64(len(query.Body))
+	}
+
+	concurrency, hosts := max(load.Concurrency, 1), max(load.Hosts, 1)
+	perHost := len(queries) * repeats
+	rounds := (perHost + concurrency - 1) / concurrency
+	think := (load.Think.Min + load.Think.Max) / 2
+	duration := time.Duration(rounds) * (load.Latency + think)
+	if load.RPS > 0 {
+		duration = max(duration, time.Duration(float64(perHost)/load.RPS*float64(time.Second)))
+	}
+	return runEstimate{
+		Requests: perHost * hosts,
+		Bytes:    bytes * int64(repeats*hosts),
+		Duration: duration,
+	}
+}
+
+func (e runEstimate) print(latency time.Duration) {
+	fmt.Println("Estimated run cost:")
+	fmt.Printf("  Requests: %d\n", e.Requests)
+	fmt.Printf("  Bytes sent: %s\n", formatBytes(e.Bytes))
+	fmt.Printf("  Duration: %v (assuming %v per request)\n", e.Duration, latency)
+}
+
+// formatBytes renders n using binary units, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
+
+// confirm asks question on stdout and reports whether the answer read from
+// in was yes.
+func confirm(in io.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
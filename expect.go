@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExpectedResult is one entry of an expected-results file. TotalHits and
+// TopIDs are both optional; only the expectations that are present are checked.
+type ExpectedResult struct {
+	Query     map[string]interface{} `json:"query"`
+	TotalHits *int                   `json:"total_hits,omitempty"`
+	TopIDs    []string               `json:"top_ids,omitempty"`
+}
+
+func loadExpectedResults(path string) ([]ExpectedResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var expected []ExpectedResult
+	if err := json.Unmarshal(data, &expected); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %v", path, err)
+	}
+
+	for i, exp := range expected {
+		if len(exp.Query) == 0 {
+			return nil, fmt.Errorf("entry %d in %s has no query", i, path)
+		}
+		if exp.TotalHits == nil && len(exp.TopIDs) == 0 {
+			return nil, fmt.Errorf("entry %d in %s has neither total_hits nor top_ids", i, path)
+		}
+	}
+
+	return expected, nil
+}
+
+// compareExpected returns one message per expectation that result does not meet.
+func compareExpected(exp ExpectedResult, result QueryResult) []string {
+	switch {
+	case result.Skipped:
+		return []string{"query skipped"}
+	case result.Error != nil:
+		return []string{fmt.Sprintf("query failed: %v", result.Error)}
+	case result.Result == nil:
+		return []string{"no result"}
+	}
+
+	var mismatches []string
+	if exp.TotalHits != nil && result.Result.Total != *exp.TotalHits {
+		mismatches = append(mismatches, fmt.Sprintf("total_hits: expected %d, got %d", *exp.TotalHits, result.Result.Total))
+	}
+
+	for i, id := range exp.TopIDs {
+		if i >= len(result.Result.Hits) {
+			mismatches = append(mismatches, fmt.Sprintf("top_ids: expected %d hits, got %d", len(exp.TopIDs), len(result.Result.Hits)))
+			break
+		}
+		if got := result.Result.Hits[i].ID; got != id {
+			mismatches = append(mismatches, fmt.Sprintf("top_ids[%d]: expected %s, got %s", i, id, got))
+		}
+	}
+
+	return mismatches
+}
+
+// RunExpectedResults runs every expected query once and prints a pass/fail
+// line per query followed by the overall tally. Queries a stopped run never
+// got to fail as not run. It reports whether all queries matched their
+// expectations.
+func (bs *BatchSearcher) RunExpectedResults(ctx context.Context, indexName string, expected []ExpectedResult, batchSize int) (bool, error) {
+	queries := make([]BatchQuery, 0, len(expected))
+	for i, exp := range expected {
+		queryJSON, err := json.Marshal(Query{Query: exp.Query})
+		if err != nil {
+			return false, fmt.Errorf("failed to serialize expected query %d: %v", i, err)
+		}
+		queries = append(queries, BatchQuery{Type: queryType(exp.Query), Body: string(queryJSON)})
+	}
+
+	_, _, results := bs.RunBatchSearch(ctx, []string{indexName}, queries, batchSize)
+
+	passed := 0
+	for i, exp := range expected {
+		if i >= len(results) {
+			fmt.Printf("FAIL query %d: not run\n", i)
+			continue
+		}
+		mismatches := compareExpected(exp, results[i])
+		if len(mismatches) == 0 {
+			passed++
+			fmt.Printf("PASS query %d\n", i)
+			continue
+		}
+		fmt.Printf("FAIL query %d: %s\n", i, strings.Join(mismatches, "; "))
+	}
+
+	fmt.Printf("Passed: %d\n", passed)
+	fmt.Printf("Failed: %d\n", len(expected)-passed)
+
+	return passed == len(expected), nil
+}
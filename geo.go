@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// metersPerUnit converts each of distanceUnits to meters.
+var metersPerUnit = map[string]float64{
+	"mm": 0.001, "cm": 0.01, "in": 0.0254, "ft": 0.3048, "yd": 0.9144,
+	"mi": 1609.344, "km": 1000, "nm": 1852, "m": 1,
+}
+
+// metersPerDegree is the length of one degree of latitude, near enough.
+const metersPerDegree = 111320
+
+// boundingBoxQuery builds a geo bounding box search centered on loc, as wide
+// and as tall as twice the radius a location search would use, so the two
+// geo shapes cover comparable areas.
+func (o GeneratorOptions) boundingBoxQuery(loc Root, rng *rand.Rand) GeoBoundingBoxQuery {
+	coords := loc.Bklctrcb.Geometry.Coordinates
+	lon, lat := coords[0], coords[1]
+
+	// The distance is validated when the options are parsed.
+	value, unit, _ := parseDistance(o.distance(rng))
+	dLat := value * metersPerUnit[unit] / metersPerDegree
+	// Degrees of longitude shrink towards the poles.
+	dLon := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > dLat/180 {
+		dLon = math.Min(dLat/cos, 180)
+	}
+
+	query := GeoBoundingBoxQuery{}
+	query.Query.TopLeft.Lon = math.Max(lon-dLon, -180)
+	query.Query.TopLeft.Lat = math.Min(lat+dLat, 90)
+	query.Query.BottomRight.Lon = math.Min(lon+dLon, 180)
+	query.Query.BottomRight.Lat = math.Max(lat-dLat, -90)
+	query.Query.Field = "bklctrcb.geometry.coordinates"
+	return query
+}
+
+// defaultPolygonVertices is how many vertices a generated polygon has.
+const defaultPolygonVertices = 5
+
+func (o GeneratorOptions) polygonVertices() int {
+	if o.PolygonVertices > 0 {
+		return o.PolygonVertices
+	}
+	return defaultPolygonVertices
+}
+
+// polygonQuery builds a geo polygon search whose vertices are loc and its
+// nearest neighbours among locations, ordered by angle around their centroid
+// so the polygon does not cross itself. locations must hold at least as many
+// distinct points as the polygon has vertices.
+func (o GeneratorOptions) polygonQuery(loc Root, locations []Root) GeoPolygonQuery {
+	n := o.polygonVertices()
+	vertices := nearestPoints(pointOf(loc), locations, n)
+
+	var centroid geoPoint
+	for _, vertex := range vertices {
+		centroid.Lon += vertex.Lon / float64(len(vertices))
+		centroid.Lat += vertex.Lat / float64(len(vertices))
+	}
+	sort.Slice(vertices, func(i, j int) bool {
+		return math.Atan2(vertices[i].Lat-centroid.Lat, vertices[i].Lon-centroid.Lon) <
+			math.Atan2(vertices[j].Lat-centroid.Lat, vertices[j].Lon-centroid.Lon)
+	})
+
+	query := GeoPolygonQuery{}
+	query.Query.PolygonPoints = vertices
+	query.Query.Field = "bklctrcb.geometry.coordinates"
+	return query
+}
+
+func pointOf(loc Root) geoPoint {
+	coords := loc.Bklctrcb.Geometry.Coordinates
+	return geoPoint{Lon: coords[0], Lat: coords[1]}
+}
+
+// nearestPoints returns the n distinct points of locations closest to
+// center, which is always among them, closest first.
+func nearestPoints(center geoPoint, locations []Root, n int) []geoPoint {
+	// An equirectangular approximation ranks nearby points well enough.
+	scale := math.Cos(center.Lat * math.Pi / 180)
+	dist := func(p geoPoint) float64 {
+		dLon, dLat := (p.Lon-center.Lon)*scale, p.Lat-center.Lat
+		return dLon*dLon + dLat*dLat
+	}
+
+	nearest := []geoPoint{center}
+	seen := map[geoPoint]bool{center: true}
+	for _, loc := range locations {
+		p := pointOf(loc)
+		if seen[p] {
+			continue
+		}
+		if len(nearest) == n && dist(p) >= dist(nearest[n-1]) {
+			continue
+		}
+		seen[p] = true
+		if len(nearest) == n {
+			delete(seen, nearest[n-1])
+			nearest = nearest[:n-1]
+		}
+		i := sort.Search(len(nearest), func(i int) bool { return dist(nearest[i]) > dist(p) })
+		nearest = append(nearest, geoPoint{})
+		copy(nearest[i+1:], nearest[i:])
+		nearest[i] = p
+	}
+	return nearest
+}
+
+// distinctPoints counts the distinct coordinates among locations.
+func distinctPoints(locations []Root) int {
+	seen := make(map[geoPoint]bool, len(locations))
+	for _, loc := range locations {
+		seen[pointOf(loc)] = true
+	}
+	return len(seen)
+}
+
+// checkCoordinates returns locations without the entries whose coordinates
+// lack a longitude or latitude, which would otherwise crash generation. It
+// warns how many were skipped, and how many of the rest are outside
+// -180..180 longitude or -90..90 latitude, which FTS may reject.
+func checkCoordinates(path string, locations []Root) []Root {
+	valid := locations[:0]
+	malformed, outOfRange := 0, 0
+	for _, loc := range locations {
+		coords := loc.Bklctrcb.Geometry.Coordinates
+		if len(coords) < 2 {
+			malformed++
+			continue
+		}
+		if coords[0] < -180 || coords[0] > 180 || coords[1] < -90 || coords[1] > 90 {
+			outOfRange++
+		}
+		valid = append(valid, loc)
+	}
+	if malformed > 0 {
+		slog.Warn("skipped locations without a longitude and latitude", "file", path, "count", malformed)
+	}
+	if outOfRange > 0 {
+		slog.Warn("locations have coordinates out of range", "file", path, "count", outOfRange)
+	}
+	return valid
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// stabilityGoal describes when a run's p99 latency estimate is considered
+// stable.
+type stabilityGoal struct {
+	// Tolerance is the largest relative change in p99 between consecutive
+	// batches that still counts as stable, e.g. 0.05 for 5%.
+	Tolerance float64
+	// Windows is how many consecutive batches must be stable.
+	Windows int
+	// MaxBatches stops the run even if the p99 never stabilizes.
+	MaxBatches int
+}
+
+// RunUntilStable runs queries as repeated batches until the p99 latency over
+// everything run so far changes by no more than goal.Tolerance for
+// goal.Windows consecutive batches, or goal.MaxBatches batches have run.
+// Results from all batches are returned together, indexed in run order.
+func (bs *BatchSearcher) RunUntilStable(ctx context.Context, indexNames []string, queries []BatchQuery, batchSize int, goal stabilityGoal) (int64, int64, []QueryResult) {
+	var (
+		successCount int64
+		failureCount int64
+		results      []QueryResult
+		previousP99  time.Duration
+		stable       int
+	)
+
+	for batch := 1; batch <= goal.MaxBatches; batch++ {
+		if ctx.Err() != nil || bs.stopping() {
+			fmt.Printf("Stopped after %d batches (%d queries)\n", batch-1, len(results))
+			return successCount, failureCount, results
+		}
+		success, failure, batchResults := bs.RunBatchSearch(ctx, indexNames, queries, batchSize)
+		successCount += success
+		failureCount += failure
+		for _, result := range batchResults {
+			result.QueryIndex += len(results)
+			results = append(results, result)
+		}
+
+		latencies := successLatencies(results)
+		if len(latencies) == 0 {
+			stable = 0
+			fmt.Printf("Batch %d: p99 n/a (no successful queries)\n", batch)
+			continue
+		}
+
+		p99 := percentile(latencies, 99)
+		if previousP99 > 0 {
+			change := float64(p99-previousP99) / float64(previousP99)
+			if change < 0 {
+				change = -change
+			}
+			if change <= goal.Tolerance {
+				stable++
+			} else {
+				stable = 0
+			}
+			fmt.Printf("Batch %d: p99 %v (%.1f%% change)\n", batch, p99, change*100)
+		} else {
+			fmt.Printf("Batch %d: p99 %v\n", batch, p99)
+		}
+		previousP99 = p99
+
+		if stable >= goal.Windows {
+			fmt.Printf("p99 converged to %v after %d queries (%d batches)\n", p99, len(results), batch)
+			return successCount, failureCount, results
+		}
+	}
+
+	fmt.Printf("p99 did not converge within %d batches (%d queries)\n", goal.MaxBatches, len(results))
+	return successCount, failureCount, results
+}
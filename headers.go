@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// headerFlag collects repeated -header "Key: Value" flags into the headers
+// sent with every request.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var pairs []string
+	for name, values := range h {
+		for _, value := range values {
+			pairs = append(pairs, name+": "+value)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func (h headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("want \"Key: Value\", got %q", value)
+	}
+	http.Header(h).Add(name, strings.TrimSpace(val))
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printHeaderDistributions prints, for each captured header, how many of the
+// queries that were sent saw each value, which shows routing across backend
+// nodes and cache hit ratios.
+func printHeaderDistributions(results []QueryResult, names []string) {
+	for _, name := range names {
+		counts := make(map[string]int)
+		sent := 0
+		for _, result := range results {
+			if result.Skipped {
+				continue
+			}
+			sent++
+			value, ok := result.Headers[name]
+			if !ok {
+				value = "(absent)"
+			}
+			counts[value]++
+		}
+		if sent == 0 {
+			continue
+		}
+
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if counts[values[i]] != counts[values[j]] {
+				return counts[values[i]] > counts[values[j]]
+			}
+			return values[i] < values[j]
+		})
+
+		fmt.Printf("Response header %s:\n", name)
+		for _, value := range values {
+			fmt.Printf("  %s: %d (%.1f%%)\n", value, counts[value], 100*float64(counts[value])/float64(sent))
+		}
+	}
+}
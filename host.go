@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// normalizeHost checks that host is a usable FTS endpoint URL and returns it
+// in the form performSearch expects: with a scheme, defaulting to https, and
+// without a trailing slash.
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return "", errors.New("-host is required, e.g. http://127.0.0.1:8094")
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid -host %q: %v", host, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid -host %q: scheme must be http or https", host)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid -host %q: missing host name", host)
+	}
+	return strings.TrimRight(host, "/"), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// interactiveHits is how many of the top hits are printed per response.
+const interactiveHits = 5
+
+// maxInteractiveLine bounds the length of one query typed or piped into
+// -interactive.
+const maxInteractiveLine = 16 << 20
+
+// RunInteractive reads one JSON query per line from in, sends each to
+// indexName and prints the response to out, until in is exhausted. A line that
+// is not JSON or a query that fails is reported, and the next line is read.
+func (bs *BatchSearcher) RunInteractive(ctx context.Context, indexName string, in *os.File, out io.Writer) error {
+	prompt := isTerminal(in)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInteractiveLine)
+	for {
+		if prompt {
+			fmt.Fprint(out, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := bs.RunQuery(ctx, indexName, line, out); err != nil {
+			fmt.Fprintln(out, err)
+		}
+	}
+	if prompt {
+		fmt.Fprintln(out)
+	}
+	return scanner.Err()
+}
+
+// errNotJSON is returned by RunQuery for a query that is not valid JSON.
+var errNotJSON = errors.New("not a JSON query")
+
+// RunQuery sends one JSON query to indexName and prints the response to out.
+func (bs *BatchSearcher) RunQuery(ctx context.Context, indexName, query string, out io.Writer) error {
+	if !json.Valid([]byte(query)) {
+		return errNotJSON
+	}
+	start := time.Now()
+	result, _, err := bs.performSearch(ctx, indexName, query)
+	if err != nil {
+		return fmt.Errorf("query failed after %v: %w", time.Since(start).Round(time.Millisecond), err)
+	}
+	printSearchResult(out, result, time.Since(start))
+	return nil
+}
+
+// printSearchResult prints the hit count, server and round-trip time and the
+// top interactiveHits hits of a search response.
+func printSearchResult(out io.Writer, result *SearchResult, elapsed time.Duration) {
+	fmt.Fprintf(out, "Hits: %d (max score %.4f), took %v on the server, %v round trip\n",
+		result.Total, result.MaxScore, time.Duration(result.Took).Round(time.Microsecond), elapsed.Round(time.Millisecond))
+	for i, hit := range result.Hits {
+		if i == interactiveHits {
+			fmt.Fprintf(out, "  ... %d more\n", len(result.Hits)-interactiveHits)
+			break
+		}
+		fmt.Fprintf(out, "  %d. %s (score %.4f)\n", i+1, hit.ID, hit.Score)
+	}
+}
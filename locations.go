@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Locations file formats accepted by -locations-format.
+const (
+	locationsJSON = "json"
+	locationsCSV  = "csv"
+)
+
+func validateLocationsFormat(format string) error {
+	switch format {
+	case "", locationsJSON, locationsCSV:
+		return nil
+	}
+	return fmt.Errorf("unknown locations format %q (want %s or %s)", format, locationsJSON, locationsCSV)
+}
+
+// locationsFormat returns the format of the locations file at path: format
+// if set, otherwise csv for a .csv file and json for anything else.
+func locationsFormat(path, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return locationsCSV
+	}
+	return locationsJSON
+}
+
+// parseCSVLocations parses locations from CSV with a header row naming a lon
+// and a lat column and, optionally, a relationship column. Any other column is
+// kept as a location field under its header, which may be a dotted path such
+// as bklctrcb.address.line1. Rows whose coordinates do not parse are kept
+// without coordinates, for loadLocations to skip and count.
+func parseCSVLocations(data []byte) ([]Root, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	lonColumn, latColumn, relationshipColumn := -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "lon":
+			lonColumn = i
+		case "lat":
+			latColumn = i
+		case "relationship":
+			relationshipColumn = i
+		}
+	}
+	if lonColumn < 0 || latColumn < 0 {
+		return nil, fmt.Errorf("header %q needs lon and lat columns", strings.Join(header, ","))
+	}
+
+	locations := make([]Root, 0, len(records)-1)
+	for _, record := range records[1:] {
+		var loc Root
+		loc.fields = make(map[string]interface{})
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(record[lonColumn]), 64)
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[latColumn]), 64)
+		if lonErr == nil && latErr == nil {
+			loc.Bklctrcb.Geometry.Coordinates = []float64{lon, lat}
+			setField(loc.fields, "bklctrcb.geometry.coordinates", []interface{}{lon, lat})
+		}
+		if relationshipColumn >= 0 {
+			loc.Bklctrcb.Relationship = record[relationshipColumn]
+			setField(loc.fields, "bklctrcb.relationship", record[relationshipColumn])
+		}
+		for i, value := range record {
+			if i != lonColumn && i != latColumn && i != relationshipColumn {
+				setField(loc.fields, strings.TrimSpace(header[i]), value)
+			}
+		}
+		locations = append(locations, loc)
+	}
+	return locations, nil
+}
+
+// setField stores value in fields at a dotted path, the way Root.lookup
+// reads it back.
+func setField(fields map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := fields[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			fields[key] = child
+		}
+		fields = child
+	}
+	fields[keys[len(keys)-1]] = value
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Formats accepted by -log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// setupLogging sends log records at level and above to stderr in the given
+// format, for both slog and the standard log package.
+func setupLogging(level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q (want debug, info, warn or error)", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case logFormatText:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (want %s or %s)", format, logFormatText, logFormatJSON)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatalf logs an error and exits with status 1.
+func fatalf(format string, args ...interface{}) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
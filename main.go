@@ -5,24 +5,35 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Query struct {
-	Query map[string]interface{} `json:"query"`
+	Query  map[string]interface{} `json:"query"`
+	Size   *int                   `json:"size,omitempty"`
+	From   *int                   `json:"from,omitempty"`
+	Fields []string               `json:"fields,omitempty"`
+	Sort   []interface{}          `json:"sort,omitempty"`
 }
 
 type ResultOutput struct {
 	Query   QueryResult `json:"query_result"`
 	Success bool        `json:"success"`
+	// Data is the search response reshaped by -transform, if one is set.
+	Data map[string]interface{} `json:"data,omitempty"`
 }
 
 type SearchHit struct {
@@ -33,212 +44,1782 @@ type SearchHit struct {
 }
 
 type SearchResult struct {
-	Status   interface{} `json:"status"`
-	Total    int         `json:"total_hits"`
-	Hits     []SearchHit `json:"hits"`
-	Took     int64       `json:"took"`
-	MaxScore float64     `json:"max_score"`
+	Status interface{} `json:"status"`
+	Total  int         `json:"total_hits"`
+	Hits   []SearchHit `json:"hits"`
+	// Took is the time the server spent on the search, in nanoseconds.
+	Took     int64   `json:"took"`
+	MaxScore float64 `json:"max_score"`
+}
+
+// Where a GET request carries the query.
+const (
+	getQueryInBody  = "body"
+	getQueryInParam = "param"
+	// getQueryInBase64 sends the source parameter base64-encoded, for
+	// gateways that mangle raw JSON in URLs.
+	getQueryInBase64 = "param-base64"
+)
+
+// defaultTimeout is the HTTP client timeout used when none is configured.
+const defaultTimeout = 30 * time.Second
+
+// defaultPathTemplate is the Couchbase FTS query endpoint. {host} and {index}
+// are replaced by the host and index name.
+const defaultPathTemplate = "{host}/api/index/{index}/query"
+
+// SearcherOptions holds the request settings of a BatchSearcher that have
+// sensible defaults.
+type SearcherOptions struct {
+	// Timeout bounds each HTTP request. Zero means defaultTimeout.
+	Timeout time.Duration
+	// PathTemplate is the URL queries are sent to, with {host} and {index}
+	// placeholders. Empty means defaultPathTemplate.
+	PathTemplate string
+	// Method is the HTTP method of search requests, GET or POST. Empty means POST.
+	Method string
+	// GetQueryIn selects whether GET requests send the query as the request
+	// body or as a URL parameter. Empty means the body.
+	GetQueryIn string
+	// MaxQueryBytes refuses to send queries larger than this many bytes.
+	// Zero means no limit.
+	MaxQueryBytes int
+	// MinHits counts a successful response whose total_hits is below it as
+	// a failure, to catch queries that silently match nothing. Zero disables
+	// the check.
+	MinHits int
+	// TypeControl, if set, is consulted before each dispatch so that query
+	// types can be disabled mid-run.
+	TypeControl *typeControl
+	// Headers are added to every request, replacing any header of the same
+	// name the searcher would set itself.
+	Headers http.Header
+	// Breaker, if set, is consulted before each dispatch so that dispatch
+	// pauses while the server is failing. Results must be passed to its
+	// record method, typically from OnResult.
+	Breaker *circuitBreaker
+	// Metrics, if set, is updated by the workers as queries are sent and
+	// complete.
+	Metrics *runMetrics
+	// CaptureHeaders names the response headers to record on each result.
+	CaptureHeaders []string
+	// Region labels every result with where the run was made from, so
+	// results from several regions can be merged and compared.
+	Region string
+	// OnResult, if set, is called with every completed query as soon as it
+	// finishes, one query at a time.
+	OnResult func(QueryResult)
+	// Quiet stops every failed query from being logged as it happens.
+	Quiet bool
+	// Verbose logs every request, with its Authorization header redacted,
+	// and every response in full at debug level.
+	Verbose bool
+	// Compress gzips request bodies and sends them with Content-Encoding:
+	// gzip. Gzipped responses are accepted either way.
+	Compress bool
+	// TraceTiming records the DNS, connect and TLS times of each request and
+	// whether its connection was reused.
+	TraceTiming bool
+	// DiscardHits drops the hits of each response once OnResult has seen it,
+	// so that runs streaming their results elsewhere do not keep every
+	// response in memory.
+	DiscardHits bool
+	// Retries is how many times a query that failed with a connection error
+	// or a 5xx or 429 response is retried.
+	Retries int
+	// RetryBackoff is the wait before the first retry; it doubles for every
+	// further retry.
+	RetryBackoff time.Duration
+	// RetryBudget, if set, caps the retries made across every query.
+	RetryBudget *retryBudget
+	// RPS caps how many queries are dispatched per second, on top of the
+	// concurrency limit. Zero means no rate limit.
+	RPS float64
+	// ThinkTime is how long each worker pauses between its queries. The zero
+	// value dispatches them back to back.
+	ThinkTime thinkTime
+	// RampUp is how long the run takes to grow from one worker to its full
+	// concurrency. Zero starts every worker at once.
+	RampUp time.Duration
+	// MaxIdleConns and MaxIdleConnsPerHost size the pool of idle connections
+	// kept for reuse; zero keeps the net/http defaults, which keep only two
+	// per host. MaxConnsPerHost caps all connections to the host; zero means
+	// no limit.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	// Proxy is the URL of the proxy every request goes through, overriding
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables that are
+	// honored otherwise.
+	Proxy string
+	// TLS configures client certificates and trusted CAs for HTTPS hosts.
+	TLS TLSOptions
+}
+
+// errQueryTooLarge is returned for queries refused by the MaxQueryBytes guard.
+var errQueryTooLarge = errors.New("query exceeds -max-query-bytes")
+
+// errTooFewHits marks successful responses with fewer hits than MinHits.
+var errTooFewHits = errors.New("fewer hits than -min-hits")
+
+// validate checks that the method and query placement can be used together
+// against the FTS query endpoint.
+func (o SearcherOptions) validate() error {
+	if o.Timeout < 0 {
+		return fmt.Errorf("timeout must be positive, got %v", o.Timeout)
+	}
+	if o.PathTemplate != "" && !strings.Contains(o.PathTemplate, "{index}") {
+		return fmt.Errorf("path template %q must contain {index}", o.PathTemplate)
+	}
+	if o.Retries < 0 || o.RetryBackoff < 0 {
+		return errors.New("retries and retry backoff must not be negative")
+	}
+	if o.MaxIdleConns < 0 || o.MaxIdleConnsPerHost < 0 || o.MaxConnsPerHost < 0 {
+		return errors.New("connection pool limits must not be negative")
+	}
+	if o.MinHits < 0 {
+		return fmt.Errorf("min hits must not be negative, got %d", o.MinHits)
+	}
+	if o.RampUp < 0 {
+		return fmt.Errorf("ramp-up must not be negative, got %v", o.RampUp)
+	}
+	if o.RPS < 0 {
+		return fmt.Errorf("rps must not be negative, got %v", o.RPS)
+	}
+	switch o.Method {
+	case "", http.MethodPost:
+		if o.GetQueryIn != "" && o.GetQueryIn != getQueryInBody {
+			return fmt.Errorf("query placement %q requires method GET", o.GetQueryIn)
+		}
+	case http.MethodGet:
+		switch o.GetQueryIn {
+		case "", getQueryInBody, getQueryInParam, getQueryInBase64:
+		default:
+			return fmt.Errorf("unknown query placement %q (want %s, %s or %s)", o.GetQueryIn, getQueryInBody, getQueryInParam, getQueryInBase64)
+		}
+	default:
+		return fmt.Errorf("unsupported method %q (want GET or POST)", o.Method)
+	}
+	return nil
 }
 
 type BatchSearcher struct {
-	baseURL  string
-	username string
-	password string
-	client   *http.Client
+	baseURL       string
+	pathTemplate  string
+	auth          authenticator
+	method        string
+	getQueryIn    string
+	maxQueryBytes int
+	minHits       int
+	control       *typeControl
+	breaker       *circuitBreaker
+	metrics       *runMetrics
+	headers       http.Header
+	headerNames   []string
+	region        string
+	onResult      func(QueryResult)
+	discardHits   bool
+	quiet         bool
+	verbose       bool
+	compress      bool
+	traceTiming   bool
+	retries       int
+	retryBackoff  time.Duration
+	retryBudget   *retryBudget
+	rps           float64
+	thinkTime     thinkTime
+	rampUp        time.Duration
+	rampedUp      bool
+	client        *http.Client
+
+	// completed and failed count finished queries across runs, for progress
+	// reporting.
+	completed int64
+	failed    int64
+
+	// stop is closed by Stop to end dispatching.
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Stop makes running and future runs dispatch no further queries. Queries
+// already in flight are left to finish, so their results are kept.
+func (bs *BatchSearcher) Stop() {
+	bs.stopOnce.Do(func() { close(bs.stop) })
 }
 
-func NewBatchSearcher(host string, username, password string) *BatchSearcher {
-	return &BatchSearcher{
-		baseURL:  host,
-		username: username,
-		password: password,
+// stopping reports whether Stop has been called.
+func (bs *BatchSearcher) stopping() bool {
+	select {
+	case <-bs.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Completed returns how many queries this searcher has finished so far.
+func (bs *BatchSearcher) Completed() int64 {
+	return atomic.LoadInt64(&bs.completed)
+}
+
+// Failed returns how many of the completed queries failed.
+func (bs *BatchSearcher) Failed() int64 {
+	return atomic.LoadInt64(&bs.failed)
+}
+
+func NewBatchSearcher(host string, auth authenticator, opts SearcherOptions) (*BatchSearcher, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	bs := &BatchSearcher{
+		baseURL:       host,
+		pathTemplate:  opts.PathTemplate,
+		auth:          auth,
+		method:        opts.Method,
+		getQueryIn:    opts.GetQueryIn,
+		maxQueryBytes: opts.MaxQueryBytes,
+		minHits:       opts.MinHits,
+		control:       opts.TypeControl,
+		breaker:       opts.Breaker,
+		metrics:       opts.Metrics,
+		region:        opts.Region,
+		onResult:      opts.OnResult,
+		discardHits:   opts.DiscardHits,
+		quiet:         opts.Quiet,
+		verbose:       opts.Verbose,
+		compress:      opts.Compress,
+		traceTiming:   opts.TraceTiming,
+		retries:       opts.Retries,
+		retryBackoff:  opts.RetryBackoff,
+		retryBudget:   opts.RetryBudget,
+		rps:           opts.RPS,
+		thinkTime:     opts.ThinkTime,
+		rampUp:        opts.RampUp,
 		client: &http.Client{
-			Timeout: time.Second * 30,
+			Timeout: opts.Timeout,
 		},
+		stop: make(chan struct{}),
 	}
+	if bs.client.Timeout == 0 {
+		bs.client.Timeout = defaultTimeout
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: want e.g. http://proxy.example.com:3128", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	bs.client.Transport = transport
+	if bs.pathTemplate == "" {
+		bs.pathTemplate = defaultPathTemplate
+	}
+	if bs.method == "" {
+		bs.method = http.MethodPost
+	}
+	if bs.getQueryIn == "" {
+		bs.getQueryIn = getQueryInBody
+	}
+	bs.headers = opts.Headers.Clone()
+	for _, name := range opts.CaptureHeaders {
+		bs.headerNames = append(bs.headerNames, http.CanonicalHeaderKey(name))
+	}
+	return bs, nil
 }
 
 func createSearchPayload(query string) ([]byte, error) {
 	return []byte(query), nil
 }
 
-func (bs *BatchSearcher) performSearch(ctx context.Context, indexName, query string) (*SearchResult, error) {
-	url := fmt.Sprintf("%s/api/index/%s/query", bs.baseURL, indexName)
+func (bs *BatchSearcher) performSearch(ctx context.Context, indexName, query string) (*SearchResult, responseInfo, error) {
+	var info responseInfo
+
+	reqURL := bs.endpoint(indexName)
 
 	payload, err := createSearchPayload(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create payload: %v", err)
+		return nil, info, fmt.Errorf("failed to create payload: %v", err)
+	}
+	if bs.maxQueryBytes > 0 && len(payload) > bs.maxQueryBytes {
+		return nil, info, fmt.Errorf("%w: %d bytes, limit is %d", errQueryTooLarge, len(payload), bs.maxQueryBytes)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
+	// GET gateways that disallow request bodies take the query the way
+	// Elasticsearch-style APIs do: as a source parameter plus its content type.
+	var reqBody io.Reader = bytes.NewBuffer(payload)
+	if bs.method == http.MethodGet && bs.getQueryIn != getQueryInBody {
+		params := url.Values{}
+		if bs.getQueryIn == getQueryInBase64 {
+			params.Set("source", base64.URLEncoding.EncodeToString(payload))
+			params.Set("source_encoding", "base64")
+		} else {
+			params.Set("source", string(payload))
+		}
+		params.Set("source_content_type", "application/json")
+		reqURL += "?" + params.Encode()
+		reqBody = nil
+	}
+	info.BytesSent = int64(len(payload))
+	if bs.compress && reqBody != nil {
+		compressed, err := gzipBytes(payload)
+		if err != nil {
+			return nil, info, fmt.Errorf("failed to compress payload: %v", err)
+		}
+		reqBody = bytes.NewReader(compressed)
+		info.BytesSent = int64(len(compressed))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, bs.method, reqURL, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, info, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	auth := base64.StdEncoding.EncodeToString([]byte(bs.username + ":" + bs.password))
-	req.Header.Add("Authorization", "Basic "+auth)
-	req.Header.Add("Content-Type", "application/json")
+	bs.auth.authenticate(req)
+	if reqBody != nil {
+		req.Header.Add("Content-Type", "application/json")
+		if bs.compress {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	for name, values := range bs.headers {
+		req.Header[name] = values
+	}
+	if bs.verbose {
+		sent := payload
+		if reqBody == nil {
+			sent = nil
+		}
+		logRequest(req, sent)
+	}
 
+	req, trace := traceRequest(req, &info, bs.traceTiming)
 	resp, err := bs.client.Do(req)
+	if bs.traceTiming {
+		trace.finish()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %v", err)
+		return nil, info, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
+	info.Headers = bs.captureHeaders(resp.Header)
 
-	body, err := ioutil.ReadAll(resp.Body)
+	raw, body, err := decodeBody(resp)
+	info.BytesReceived = int64(len(raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, info, fmt.Errorf("failed to read response: %w", err)
+	}
+	if bs.verbose {
+		logResponse(req.URL.Redacted(), resp, body)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+		return nil, info, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			Message:    errorMessage(body),
+			RetryAfter: resp.Header.Get("Retry-After"),
+		}
 	}
 
 	var result SearchResult
 	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+		return nil, info, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return &result, nil
+	return &result, info, nil
+}
+
+// BatchQuery is a serialized query ready for dispatch, tagged with the type
+// of query it is so results can be broken down by type.
+type BatchQuery struct {
+	Type string
+	Body string
+}
+
+// responseInfo is what performSearch records about a response besides the
+// search result itself.
+type responseInfo struct {
+	// Headers holds the captured response headers that were present.
+	Headers map[string]string
+	// BytesSent and BytesReceived are the sizes of the query payload and
+	// the response body.
+	BytesSent     int64
+	BytesReceived int64
+	// TTFB is the time from sending the request to the first byte of the
+	// response.
+	TTFB time.Duration
+	// Timing is the connection timing, recorded with TraceTiming.
+	Timing *connTiming
+}
+
+// captureHeaders picks the configured headers out of header.
+func (bs *BatchSearcher) captureHeaders(header http.Header) map[string]string {
+	if len(bs.headerNames) == 0 {
+		return nil
+	}
+	captured := make(map[string]string, len(bs.headerNames))
+	for _, name := range bs.headerNames {
+		if value := header.Get(name); value != "" {
+			captured[name] = value
+		}
+	}
+	return captured
 }
 
 type QueryResult struct {
 	QueryIndex int
-	Result     *SearchResult
-	Error      error
+	Type       string
+	// Query is the query that was sent. It is not written to the results
+	// file, which refers to queries by QueryIndex.
+	Query string `json:"-"`
+	// IndexName is the index the query was sent to.
+	IndexName string `json:",omitempty"`
+	Result    *SearchResult
+	Error     error
+	// Latency is the client-measured wall-clock duration of the request,
+	// including any retries.
+	Latency time.Duration
+	// TTFB is the time to the first byte of the response to the last
+	// attempt, before its body was read.
+	TTFB time.Duration `json:",omitempty"`
+	// Timing breaks down how the last attempt got its connection, with
+	// -trace-timing.
+	Timing *connTiming `json:",omitempty"`
+	// CompletedAt is when the last attempt of the request returned. It is
+	// zero for queries that were never sent.
+	CompletedAt time.Time
+	// Attempts is how many times the request was sent.
+	Attempts int `json:",omitempty"`
+	// Skipped is set for queries that were never sent because their type
+	// was disabled, and for queries cut off because the run was stopped.
+	Skipped bool `json:",omitempty"`
+	// BytesSent and BytesReceived total the query payloads sent and the
+	// response bodies read over every attempt.
+	BytesSent     int64 `json:",omitempty"`
+	BytesReceived int64 `json:",omitempty"`
+	// Stage is the 1-based stage of a -stages run the query was sent in.
+	Stage int `json:",omitempty"`
+	// Headers holds the response headers selected with -capture-headers.
+	Headers map[string]string `json:",omitempty"`
+	Region  string            `json:",omitempty"`
+}
+
+// RunBatchSearch runs queries against indexNames, which take the queries in
+// turn.
+func (bs *BatchSearcher) RunBatchSearch(ctx context.Context, indexNames []string, queries []BatchQuery, batchSize int) (int64, int64, []QueryResult) {
+	return bs.RunStreamSearch(ctx, indexNames, queryChannel(ctx, queries), batchSize)
+}
+
+// queryChannel returns a channel that yields queries in order and is then
+// closed, or is closed early if ctx is cancelled.
+func queryChannel(ctx context.Context, queries []BatchQuery) <-chan BatchQuery {
+	source := make(chan BatchQuery)
+	go func() {
+		defer close(source)
+		for _, query := range queries {
+			select {
+			case source <- query:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return source
 }
 
-func (bs *BatchSearcher) RunBatchSearch(ctx context.Context, indexName string, queries []string, batchSize int) (int64, int64, []QueryResult) {
+// cycleQueries returns a channel that yields queries in order, starting again
+// from the first after the last, until ctx is cancelled.
+func cycleQueries(ctx context.Context, queries []BatchQuery) <-chan BatchQuery {
+	source := make(chan BatchQuery)
+	go func() {
+		defer close(source)
+		if len(queries) == 0 {
+			return
+		}
+		for i := 0; ; i = (i + 1) % len(queries) {
+			select {
+			case source <- queries[i]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return source
+}
+
+// searchJob is a query handed to a worker, with its position in the run.
+type searchJob struct {
+	index int
+	query BatchQuery
+}
+
+// orDefault returns value, or fallback if value is zero.
+func orDefault(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// chainResults returns an OnResult callback that calls first, if set, and
+// then next.
+func chainResults(first, next func(QueryResult)) func(QueryResult) {
+	if first == nil {
+		return next
+	}
+	return func(result QueryResult) {
+		first(result)
+		next(result)
+	}
+}
+
+// RunStreamSearch is RunBatchSearch for queries that are produced while the
+// run is in progress. It dispatches queries until the channel is closed or ctx
+// is cancelled, or until Stop is called, and returns once every dispatched
+// query has finished.
+//
+// Queries are run by batchSize workers, so the number of goroutines stays
+// bounded however many queries there are. Results are returned in dispatch
+// order.
+func (bs *BatchSearcher) RunStreamSearch(ctx context.Context, indexNames []string, queries <-chan BatchQuery, batchSize int) (int64, int64, []QueryResult) {
+	return bs.runStream(ctx, indexNames, queries, batchSize, true)
+}
+
+// runStream implements RunStreamSearch. Unless measured is set, results are
+// only returned: they are not logged, counted towards Completed and Failed,
+// or passed to OnResult.
+func (bs *BatchSearcher) runStream(ctx context.Context, indexNames []string, queries <-chan BatchQuery, batchSize int, measured bool) (int64, int64, []QueryResult) {
 	var (
 		successCount int64
 		failureCount int64
-		rateLimiter  = make(chan struct{}, batchSize)
-		results      = make([]QueryResult, len(queries))
-		wg           sync.WaitGroup
+		results      []QueryResult
+		jobs         = make(chan searchJob)
+		completed    = make(chan QueryResult, batchSize)
+		workers      sync.WaitGroup
+		collected    = make(chan struct{})
 	)
 
-	for i, query := range queries {
-		wg.Add(1)
-		rateLimiter <- struct{}{}
-
-		go func(queryIndex int, searchQuery string) {
-			defer wg.Done()
-			defer func() { <-rateLimiter }()
-
-			result, err := bs.performSearch(ctx, indexName, searchQuery)
-			if err != nil {
-				atomic.AddInt64(&failureCount, 1)
-				results[queryIndex] = QueryResult{
-					QueryIndex: queryIndex,
-					Error:      err,
+	delays := bs.rampDelays(batchSize, measured)
+	for w := 0; w < batchSize; w++ {
+		workers.Add(1)
+		go func(w int) {
+			defer workers.Done()
+			if delays != nil {
+				bs.waitToStart(ctx, delays[w])
+			}
+			first := true
+			for job := range jobs {
+				if !first {
+					bs.thinkTime.pause(ctx)
 				}
-				log.Printf("Query %d failed: %v", queryIndex, err)
-			} else {
-				atomic.AddInt64(&successCount, 1)
-				results[queryIndex] = QueryResult{
-					QueryIndex: queryIndex,
-					Result:     result,
+				first = false
+				completed <- bs.runJob(ctx, indexNames, job, measured)
+			}
+		}(w)
+	}
+
+	// The collector is the only goroutine that touches results and the
+	// counts until it is done.
+	go func() {
+		defer close(collected)
+		for result := range completed {
+			for len(results) <= result.QueryIndex {
+				results = append(results, QueryResult{})
+			}
+			results[result.QueryIndex] = result
+			if result.Skipped {
+				continue
+			}
+			if !measured {
+				if result.Error != nil {
+					failureCount++
+				} else {
+					successCount++
 				}
+				continue
+			}
+			if result.Error != nil {
+				failureCount++
+				atomic.AddInt64(&bs.failed, 1)
+				if !bs.quiet {
+					slog.Warn("query failed", "query_index", result.QueryIndex, "type", result.Type, "error", result.Error)
+				}
+			} else {
+				successCount++
+				slog.Debug("query succeeded", "query_index", result.QueryIndex, "type", result.Type, "latency", result.Latency, "total_hits", result.Result.Total)
+			}
+			atomic.AddInt64(&bs.completed, 1)
+			if bs.onResult != nil {
+				bs.onResult(result)
+			}
+			if bs.discardHits && result.Result != nil {
+				trimmed := *result.Result
+				trimmed.Hits = nil
+				results[result.QueryIndex].Result = &trimmed
 			}
-		}(i, query)
+		}
+	}()
+
+	pace := newPacer(bs.rps)
+	defer pace.stop()
+
+	i := 0
+dispatch:
+	for {
+		var query BatchQuery
+		select {
+		case q, ok := <-queries:
+			if !ok {
+				break dispatch
+			}
+			query = q
+		case <-bs.stop:
+			break dispatch
+		}
+		if ctx.Err() != nil {
+			break dispatch
+		}
+		if bs.control != nil && bs.control.skip(query.Type) {
+			completed <- QueryResult{QueryIndex: i, Type: query.Type, Skipped: true, Region: bs.region}
+			i++
+			continue
+		}
+		if !bs.breaker.wait(ctx, bs.stop) || !pace.wait(ctx) {
+			break dispatch
+		}
+		jobs <- searchJob{index: i, query: query}
+		i++
 	}
 
-	wg.Wait()
+	close(jobs)
+	workers.Wait()
+	close(completed)
+	<-collected
 
 	return successCount, failureCount, results
 }
 
+// runJob runs one query, with retries, and describes how it went. Queries
+// are spread over indexNames round-robin by their position in the run, each
+// round starting one index later than the last so that query types, which
+// repeat in a fixed cycle, are not all sent to the same index. Only measured
+// queries are recorded in the metrics.
+func (bs *BatchSearcher) runJob(ctx context.Context, indexNames []string, job searchJob, measured bool) QueryResult {
+	n := len(indexNames)
+	indexName := indexNames[(job.index+job.index/n)%n]
+	metrics := bs.metrics
+	if !measured {
+		metrics = nil
+	}
+	metrics.started()
+	start := time.Now()
+	result, info, attempts, err := bs.searchWithRetry(ctx, indexName, job.query.Body)
+	latency := time.Since(start)
+
+	queryResult := QueryResult{
+		QueryIndex:    job.index,
+		Type:          job.query.Type,
+		Query:         job.query.Body,
+		IndexName:     indexName,
+		Latency:       latency,
+		CompletedAt:   start.Add(latency),
+		TTFB:          info.TTFB,
+		Timing:        info.Timing,
+		Attempts:      attempts,
+		Headers:       info.Headers,
+		Region:        bs.region,
+		BytesSent:     info.BytesSent,
+		BytesReceived: info.BytesReceived,
+	}
+	switch {
+	case err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		// Still in flight when the run was stopped; not a failure.
+		queryResult.Skipped = true
+	case err != nil:
+		queryResult.Error = err
+	case result.Total < bs.minHits:
+		queryResult.Error = fmt.Errorf("%w: %d hits, want at least %d", errTooFewHits, result.Total, bs.minHits)
+	default:
+		queryResult.Result = result
+	}
+	metrics.finished(queryResult)
+	return queryResult
+}
+
+// queriesFromStdin is the -queries-file value that reads queries from stdin.
+const queriesFromStdin = "-"
+
+// loadBatchQueries reads the queries in queriesFile, generating numQueries of
+// them first if the file does not exist. A queriesFile of queriesFromStdin
+// reads them from stdin instead, and never generates any. Each query is
+// checked with validateQuery, strictly if strict is set.
+func loadBatchQueries(queriesFile string, numQueries int, genOpts GeneratorOptions, strict bool) ([]BatchQuery, error) {
+	var (
+		queries []Query
+		data    []byte
+		err     error
+		source  = queriesFile
+	)
+
+	if queriesFile == queriesFromStdin {
+		source = "stdin"
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		if _, err := os.Stat(queriesFile); os.IsNotExist(err) {
+			fmt.Printf("%s not found, generating it...\n", queriesFile)
+			if err := GenerateQueries(numQueries, queriesFile, genOpts); err != nil {
+				return nil, fmt.Errorf("failed to generate queries: %w", err)
+			}
+		}
+		data, err = ioutil.ReadFile(queriesFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", source, err)
+	}
+
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %v", source, err)
+	}
+	for i, query := range queries {
+		if err := validateQuery(query, strict); err != nil {
+			return nil, fmt.Errorf("invalid query %d in %s: %v", i, source, err)
+		}
+	}
+
+	batchQueries := make([]BatchQuery, 0, len(queries))
+	for _, query := range queries {
+		queryJSON, err := json.Marshal(query)
+		if err != nil {
+			slog.Error("failed to serialize query", "error", err)
+			continue
+		}
+		batchQueries = append(batchQueries, BatchQuery{Type: queryType(query.Query), Body: string(queryJSON)})
+	}
+	return batchQueries, nil
+}
+
+// repeatQueries returns queries repeated iterations times.
+func repeatQueries(queries []BatchQuery, iterations int) []BatchQuery {
+	allQueries := make([]BatchQuery, 0, len(queries)*iterations)
+	for i := 0; i < iterations; i++ {
+		allQueries = append(allQueries, queries...)
+	}
+	return allQueries
+}
+
+// newResultOutput describes result for the results file. If transform is
+// non-nil, the search response is stored in its transformed form instead of
+// as returned.
+func newResultOutput(result QueryResult, transform resultTransform) (ResultOutput, error) {
+	entry := ResultOutput{
+		Query:   result,
+		Success: result.Error == nil && !result.Skipped,
+	}
+	if transform != nil && result.Result != nil {
+		data, err := transform.apply(result.Result)
+		if err != nil {
+			return entry, fmt.Errorf("failed to transform result %d: %v", result.QueryIndex, err)
+		}
+		entry.Query.Result = nil
+		entry.Data = data
+	}
+	return entry, nil
+}
+
+// writeResults writes every result, flagged with whether it succeeded, to
+// path as an indented JSON array. If transform is non-nil, each search
+// response is stored in its transformed form instead of as returned.
+func writeResults(path string, results []QueryResult, transform resultTransform) error {
+	var output []ResultOutput
+
+	for _, result := range results {
+		entry, err := newResultOutput(result, transform)
+		if err != nil {
+			return err
+		}
+		output = append(output, entry)
+	}
+
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize results: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write to results file: %v", err)
+	}
+	return nil
+}
+
 func main() {
 	host := flag.String("host", "", "Couchbase FTS endpoint")
+	hostB := flag.String("host-b", "", "Second FTS endpoint to run every query against alongside -host, comparing their latencies")
 	username := flag.String("user", "username", "Username")
 	password := flag.String("pass", "password", "Password")
-	index := flag.String("index", "indexname", "FTS index name")
+	authMode := flag.String("auth", authBasic, "Authentication mode: basic (user and pass) or bearer (token)")
+	token := flag.String("token", "", "Bearer token or API key used with -auth bearer")
+	clientCert := flag.String("client-cert", "", "PEM client certificate for mutual TLS")
+	clientKey := flag.String("client-key", "", "PEM private key for -client-cert")
+	caCert := flag.String("ca-cert", "", "PEM CA bundle trusted for the server certificate")
+	insecure := flag.Bool("insecure", false, "Skip TLS verification of the server certificate (testing only)")
+	index := flag.String("index", "indexname", "FTS index name, or comma-separated names to spread queries across round-robin")
 	concurrency := flag.Int("concurrency", 20, "Number of concurrent requests")
 	iterations := flag.Int("iterations", 1, "Number of times to run each query")
+	stagesFile := flag.String("stages", "", "JSON file of load stages to run in turn, e.g. [{\"rps\": 10, \"duration\": \"1m\"}]")
+	rampUp := flag.Duration("ramp-up", 0, "Grow concurrency linearly from 1 to -concurrency over this long at the start of the run, e.g. 30s")
+	thinkTimeSpec := flag.String("think-time", "", "Pause each worker takes between its queries, e.g. 200ms, or a range such as 100ms-500ms")
+	rps := flag.Float64("rps", 0, "Maximum queries dispatched per second; 0 means no limit")
+	deadline := flag.Duration("deadline", 0, "Cancel the whole run, including preflight and warmup, once it has taken this long; 0 means no deadline")
+	duration := flag.Duration("duration", 0, "Run for this long, cycling through the queries, instead of for -iterations")
+	queriesFile := flag.String("queries-file", "queries.json", "Queries to run, or - for stdin; generated there first if the file does not exist")
+	locationsFile := flag.String("locations-file", defaultLocationsFile, "Locations that queries are generated from")
+	locationsFormatFlag := flag.String("locations-format", "", "Format of -locations-file: json or csv; by default csv for a .csv file and json otherwise")
+	mixSpec := flag.String("mix", "", "Relative weights of generated query types, e.g. location=70,relationship=20,conjunct=10")
+	distance := flag.String("distance", defaultDistance, "Radius of generated location searches, e.g. 100mi or 25km")
+	distanceRangeSpec := flag.String("distance-range", "", "Give each generated location search a random radius in this range, e.g. 10mi-500mi")
+	phraseField := flag.String("phrase-field", defaultPhraseField, "Location field that generated match_phrase queries take their phrase from and search in")
+	numRangeSpec := flag.String("num-range", "", "Field and span that generated numeric_range queries pick bounds from, e.g. price=0..500")
+	dateRangeSpec := flag.String("date-range", defaultDateRange, "Field and span that generated date_range queries pick bounds from")
+	size := flag.Int("size", 0, "Number of hits each generated query asks for; 0 leaves size out, so the server default applies")
+	from := flag.Int("from", 0, "Offset of the first hit each generated query asks for, to exercise deep pagination; 0 leaves from out")
+	sortSpec := flag.String("sort", "", "Comma-separated sort keys for generated queries, e.g. _score, -bklctrcb.relationship or geo_distance; prefix - for descending")
+	fields := flag.String("fields", "", "Comma-separated stored fields each generated query asks to be returned with its hits, or * for all")
+	conjuncts := flag.Int("conjuncts", defaultConjuncts, "Clauses ANDed together in each generated conjunct query, alternating location and relationship searches")
+	polygonVertices := flag.Int("polygon-vertices", defaultPolygonVertices, "Vertices of each generated polygon query, taken from nearby locations")
+	boolClauses := flag.Int("bool-clauses", defaultBoolClauses, "Clauses spread across must, should and must_not in each generated boolean query")
+	seed := flag.Int64("seed", 0, "Seed for query generation and random dispatch order; 0 means a time-based seed")
 	numQueries := flag.Int("numqueries", 300, "Must be multiple of 3")
 	printResults := flag.Bool("print-results", true, "Print search results")
+	summaryFile := flag.String("summary-file", "", "Also write a JSON rollup of the run (counts, duration, rps, latency percentiles, status counts) to this file")
+	outputFormat := flag.String("output-format", formatJSON, "Format of the results file: json, or ndjson or csv to write each result as it completes")
+	minHits := flag.Int("min-hits", 0, "Count successful responses with fewer total hits than this as failures; 0 disables")
+	maxIdleConns := flag.Int("max-idle-conns", 0, "Idle connections kept for reuse across all hosts; 0 means -concurrency")
+	maxIdleConnsPerHost := flag.Int("max-idle-conns-per-host", 0, "Idle connections kept for reuse per host; 0 means -concurrency")
+	maxConnsPerHost := flag.Int("max-conns-per-host", 0, "Maximum connections per host, idle or in use; 0 means no limit")
+	proxy := flag.String("proxy", "", "Proxy URL for every request, e.g. http://proxy:3128; overrides HTTP_PROXY and HTTPS_PROXY")
+	timeout := flag.Duration("timeout", defaultTimeout, "HTTP client timeout per request, e.g. 45s or 2m")
+	noPreflight := flag.Bool("no-preflight", false, "Skip the single query sent before the run to check the host, credentials and index")
+	compareFile := flag.String("compare-against-exact", "", "Expected-results file to check query results against")
+	pathTemplate := flag.String("path-template", defaultPathTemplate, "URL queries are sent to, with {host} and {index} placeholders, e.g. {host}/{index}/_search")
+	method := flag.String("method", http.MethodPost, "HTTP method for search requests (GET or POST)")
+	getQueryIn := flag.String("get-query-in", getQueryInBody, "Where GET requests carry the query (body, param or param-base64)")
+	slaSpec := flag.String("latency-sla-report", "", "Per-type latency SLAs to report compliance for, e.g. location=1s,relationship=200ms")
+	slaTarget := flag.Float64("sla-target", 99, "Minimum percentage of each type's queries that must meet its SLA")
+	maxQueryBytes := flag.Int("max-query-bytes", 0, "Skip generated queries and refuse to send queries larger than this many bytes (0 means no limit)")
+	maxFailures := flag.Int64("max-failures", 0, "Abort the run once more than this many queries have failed; 0 means no limit")
+	maxFailureRate := flag.Float64("max-failure-rate", 1, "Exit non-zero if more than this fraction of queries fail, e.g. 0.05; 1 never fails the run")
+	quiet := flag.Bool("quiet", false, "Do not log each failed query; summarize failures by category at the end instead")
+	progress := flag.Bool("progress", isTerminal(os.Stderr), "Print completed, successful and failed counts and the rolling rate to stderr every second (default on when stderr is a terminal)")
+	progressBar := flag.Bool("progress-bar", false, "Show a progress bar with estimated time remaining on stderr")
+	traceTiming := flag.Bool("trace-timing", false, "Record the DNS, connect and TLS times of each request and whether it reused a connection")
+	compress := flag.Bool("compress", false, "Gzip request bodies and send them with Content-Encoding: gzip")
+	verbose := flag.Bool("verbose", false, "Log every request URL, headers and body and every response status and body at debug level, with Authorization redacted")
+	logLevel := flag.String("log-level", "info", "Minimum level of log messages written to stderr: debug, info, warn or error")
+	logFormat := flag.String("log-format", logFormatText, "Format of log messages: text, or json for log aggregation")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the runner during the run to this file")
+	memProfile := flag.String("memprofile", "", "Write a heap profile of the runner at the end of the run to this file")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve live Prometheus metrics on at /metrics, e.g. localhost:9100")
+	pprofAddr := flag.String("pprof-addr", "", "Address to serve net/http/pprof profiles of the runner itself on, e.g. localhost:6060")
+	controlAddr := flag.String("control-addr", "", "Address to serve the mid-run query type control endpoint on, e.g. localhost:8095")
+	responseTimeGoal := flag.Float64("response-time-goal", 0, "Run batches until p99 latency changes by at most this fraction (e.g. 0.05) between batches; 0 disables")
+	goalWindows := flag.Int("goal-windows", 3, "Consecutive stable batches required by -response-time-goal")
+	goalMaxBatches := flag.Int("goal-max-batches", 50, "Maximum number of batches run by -response-time-goal")
+	sqliteFile := flag.String("sqlite-file", "", "SQLite database to append per-query results to")
+	dispatchOrder := flag.String("dispatch-order", orderSequential, "Order queries are dispatched in: sequential, random or interleave")
+	shuffle := flag.Bool("shuffle", false, "Shuffle the queries before dispatch, seeded by -seed; shorthand for -dispatch-order random")
+	estimate := flag.Bool("estimate", false, "Print the estimated requests, bytes sent and duration of the run, then exit")
+	confirmRun := flag.Bool("confirm", false, "Print the run estimate and ask for confirmation before running")
+	estimateLatency := flag.Duration("estimate-latency", 50*time.Millisecond, "Per-request latency assumed by -estimate and -confirm")
+	transformFile := flag.String("transform", "", "JSON file mapping output keys to JSON Pointers, used to reshape each response before it is written to results.json")
+	seedRotation := flag.Bool("seed-rotation", false, "Generate fresh queries for every iteration from an incrementing seed instead of repeating the queries file")
+	headers := headerFlag{}
+	flag.Var(headers, "header", "Header to send with every request, as \"Key: Value\"; repeatable")
+	captureHeaders := flag.String("capture-headers", "", "Comma-separated response headers to record and report distributions of, e.g. X-Cache")
+	assertZeroFailures := flag.Bool("assert-zero-failures", false, "Exit non-zero if any query fails")
+	region := flag.String("region", "", "Label attached to every result and the summary, for comparing runs made from different regions")
+	validate := flag.Bool("validate", false, "Check that every query in the queries file has the fields its query shape needs before running any")
+	dedup := flag.Bool("dedup", false, "Drop byte-identical duplicate queries from the query set before running it")
+	sample := flag.Float64("sample", 1, "Fraction of the queries to run, chosen deterministically from -sample-seed")
+	sampleSeed := flag.Int64("sample-seed", 0, "Seed that determines which queries -sample selects")
+	breakerThreshold := flag.Float64("breaker-threshold", 0, "Pause dispatch for -breaker-cooldown when the error rate over the last 50 queries exceeds this fraction; 0 disables")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "How long the circuit breaker pauses dispatch before probing the server again")
+	errorRateAlert := flag.Float64("error-rate-alert", 0, "Abort with exit status 3 as soon as the error rate over the last -error-rate-window queries exceeds this fraction; 0 disables")
+	alertWindow := flag.Int("error-rate-window", 100, "Number of most recent queries -error-rate-alert is measured over")
+	retries := flag.Int("retries", 0, "Times to retry a query that failed with a connection error or a 5xx or 429 response")
+	totalRetries := flag.Int64("retry-budget", 0, "Most retries to make across the whole run; once used up, failures are not retried. 0 means no limit")
+	retryBackoff := flag.Duration("retry-backoff", 100*time.Millisecond, "Wait before the first retry; doubles for each further retry, with jitter")
+	failedQueriesFile := flag.String("failed-queries-file", "failed-queries.json", "Write the failed queries here, replayable with -queries-file; removed after a run with no failures, and empty disables it")
+	bucketWidth := flag.Duration("bucket", 10*time.Second, "Break the summary down into intervals of this length by completion time; 0 disables it")
+	topSlow := flag.Int("top-slow", 0, "Print the N slowest queries with their latency, outcome and text")
+	baselineFile := flag.String("baseline", "", "Results file from an earlier run to compare this run's hit IDs and total_hits against, by query index; exit non-zero if any diverge")
+	repeatFailed := flag.Bool("repeat-failed", false, "After the run, send the failed queries once more and report how many recovered")
+	warmup := flag.Int("warmup", 0, "Run this many queries first to warm server caches, leaving them out of the results and statistics")
+	dryRun := flag.Bool("dry-run", false, "Print every query that would be sent, one per line, and exit without sending any")
+	singleQuery := flag.String("query", "", "Run this one JSON query against the first -index and print the response, without reading or generating a queries file")
+	interactive := flag.Bool("interactive", false, "Read one JSON query per line from stdin, send each to the first -index and print the response")
+	stream := flag.Bool("stream", false, "Generate queries on the fly and run them without reading or writing the queries file")
+	configFile := flag.String("config", "", "YAML file of flag values to use; flags given on the command line override it")
 	flag.Parse()
 
-	queriesFile := "queries.json"
-	var queries []Query
+	if *configFile != "" {
+		if err := applyConfig(*configFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	// -verbose dumps at debug level, so it lowers the default level to show them.
+	if *verbose && !flagSet("log-level") {
+		*logLevel = "debug"
+	}
+	if err := setupLogging(*logLevel, *logFormat); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	baseURL, err := normalizeHost(*host)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	*host = baseURL
+	if *hostB != "" {
+		if *hostB, err = normalizeHost(*hostB); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if *stream || *responseTimeGoal > 0 || *seedRotation || *duration > 0 || *stagesFile != "" || *compareFile != "" {
+			fmt.Println("-host-b cannot be combined with -stream, -response-time-goal, -seed-rotation, -duration, -stages or -compare-against-exact")
+			os.Exit(2)
+		}
+	}
+	if *concurrency < 1 {
+		fmt.Printf("-concurrency must be at least 1, got %d\n", *concurrency)
+		os.Exit(2)
+	}
+	if *iterations < 1 {
+		fmt.Printf("-iterations must be at least 1, got %d\n", *iterations)
+		os.Exit(2)
+	}
+	// Generation makes numqueries/3 queries of each default type.
+	if *numQueries < len(defaultTypes) {
+		fmt.Printf("-numqueries must be at least %d, got %d\n", len(defaultTypes), *numQueries)
+		os.Exit(2)
+	}
+	indexNames := splitList(*index)
+	if len(indexNames) == 0 {
+		fmt.Println("-index must name at least one index")
+		os.Exit(2)
+	}
+	if len(indexNames) > 1 && *compareFile != "" {
+		fmt.Println("-compare-against-exact checks a single index; -index names several")
+		os.Exit(2)
+	}
+	slas, err := parseLatencySLAs(*slaSpec)
+	if err != nil {
+		fmt.Printf("Invalid -latency-sla-report: %v\n", err)
+		os.Exit(2)
+	}
+	if *slaTarget < 0 || *slaTarget > 100 {
+		fmt.Println("-sla-target must be between 0 and 100")
+		os.Exit(2)
+	}
+
+	if err := validateOutputFormat(*outputFormat); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	var transform resultTransform
+	if *transformFile != "" {
+		transform, err = loadTransform(*transformFile)
+		if err != nil {
+			fmt.Printf("Invalid -transform: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if *timeout <= 0 {
+		fmt.Printf("-timeout must be positive, got %v\n", *timeout)
+		os.Exit(2)
+	}
+	if *maxFailures < 0 {
+		fmt.Println("-max-failures must not be negative")
+		os.Exit(2)
+	}
+	if *maxFailureRate < 0 || *maxFailureRate > 1 {
+		fmt.Println("-max-failure-rate must be between 0 and 1")
+		os.Exit(2)
+	}
+	if *errorRateAlert < 0 || *errorRateAlert >= 1 || *alertWindow < 1 {
+		fmt.Println("-error-rate-alert must be in [0, 1) and -error-rate-window at least 1")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		onResult func(QueryResult)
+		// alertTrigger is set, at most once, by a worker goroutine before the
+		// run finishes, so it is safe to read once run returns.
+		alertTrigger *errorRateWindow
+	)
+	if *errorRateAlert > 0 {
+		monitor := newErrorRateMonitor(*errorRateAlert, *alertWindow, func(w errorRateWindow) {
+			alertTrigger = &w
+			cancel()
+		})
+		onResult = monitor.record
+	}
+
+	if *breakerThreshold < 0 || *breakerThreshold >= 1 || *breakerCooldown <= 0 {
+		fmt.Println("-breaker-threshold must be in [0, 1) and -breaker-cooldown positive")
+		os.Exit(2)
+	}
+	if *totalRetries < 0 {
+		fmt.Println("-retry-budget must not be negative")
+		os.Exit(2)
+	}
+	var budget *retryBudget
+	if *totalRetries > 0 {
+		budget = newRetryBudget(*totalRetries)
+	}
+
+	var breaker *circuitBreaker
+	if *breakerThreshold > 0 {
+		breaker = newCircuitBreaker(*breakerThreshold, *breakerCooldown)
+		onResult = chainResults(onResult, breaker.record)
+	}
+
+	// failureLimitHit is set, like alertTrigger, once more than -max-failures
+	// queries have failed and the run has been cancelled.
+	var failureLimitHit bool
+	if *maxFailures > 0 {
+		var failures int64
+		onResult = chainResults(onResult, func(result QueryResult) {
+			if result.Error != nil && atomic.AddInt64(&failures, 1) > *maxFailures && !failureLimitHit {
+				failureLimitHit = true
+				cancel()
+			}
+		})
+	}
+
+	// streamResults writes each result to the results file as it completes,
+	// instead of all of them once the run ends.
+	streamResults := *printResults && *outputFormat != formatJSON && *compareFile == ""
+	var streamed resultWriter
+	if streamResults {
+		onResult = chainResults(onResult, func(result QueryResult) { streamed.write(result) })
+	}
+	// sqliteOut inserts each result into -sqlite-file as it completes.
+	var sqliteOut *sqliteWriter
+	runID := time.Now().UTC().Format("20060102T150405Z")
+	if *sqliteFile != "" {
+		onResult = chainResults(onResult, func(result QueryResult) { sqliteOut.write(result) })
+	}
+
+	var think thinkTime
+	if *thinkTimeSpec != "" {
+		think, err = parseThinkTime(*thinkTimeSpec)
+		if err != nil {
+			fmt.Printf("Invalid -think-time: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if *pprofAddr != "" {
+		startPprof(*pprofAddr)
+	}
+	var metrics *runMetrics
+	if *metricsAddr != "" {
+		metrics = newRunMetrics(*region)
+		metrics.serve(*metricsAddr)
+	}
 
-	if _, err := os.Stat(queriesFile); os.IsNotExist(err) {
-		fmt.Println("queries.json not found, generating it...")
-		GenerateQueries(*numQueries)
+	var control *typeControl
+	if *controlAddr != "" {
+		control = newTypeControl()
+		go func() {
+			if err := http.ListenAndServe(*controlAddr, control); err != nil {
+				slog.Error("control endpoint stopped", "error", err)
+			}
+		}()
 	}
 
-	data, err := ioutil.ReadFile(queriesFile)
+	*username = credentialFromEnv("user", *username, envUser)
+	*password = credentialFromEnv("pass", *password, envPass)
+	auth, err := newAuthenticator(*authMode, *username, *password, *token)
 	if err != nil {
-		fmt.Printf("Failed to read %s: %v\n", queriesFile, err)
+		fmt.Printf("Invalid authentication options: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: -insecure is set; server TLS certificates will NOT be verified. Do not use this outside testing.")
+	}
+
+	opts := SearcherOptions{
+		Timeout:        *timeout,
+		PathTemplate:   *pathTemplate,
+		Method:         strings.ToUpper(*method),
+		GetQueryIn:     *getQueryIn,
+		MaxQueryBytes:  *maxQueryBytes,
+		MinHits:        *minHits,
+		TypeControl:    control,
+		Breaker:        breaker,
+		Metrics:        metrics,
+		Headers:        http.Header(headers),
+		CaptureHeaders: splitList(*captureHeaders),
+		Region:         *region,
+		OnResult:       onResult,
+		DiscardHits:    streamResults,
+		Quiet:          *quiet,
+		Verbose:        *verbose,
+		Compress:       *compress,
+		TraceTiming:    *traceTiming,
+		Retries:        *retries,
+		RetryBackoff:   *retryBackoff,
+		RetryBudget:    budget,
+		RPS:            *rps,
+		ThinkTime:      think,
+		RampUp:         *rampUp,
+		// Without a pool as large as the concurrency, connections are
+		// closed and reopened constantly under load.
+		MaxIdleConns:        orDefault(*maxIdleConns, *concurrency),
+		MaxIdleConnsPerHost: orDefault(*maxIdleConnsPerHost, *concurrency),
+		MaxConnsPerHost:     *maxConnsPerHost,
+		Proxy:               *proxy,
+		TLS: TLSOptions{
+			ClientCert: *clientCert,
+			ClientKey:  *clientKey,
+			CACert:     *caCert,
+			Insecure:   *insecure,
+		},
+	}
+	searcher, err := NewBatchSearcher(*host, auth, opts)
+	if err != nil {
+		fmt.Printf("Invalid request options: %v\n", err)
+		os.Exit(2)
+	}
+	// searcherB mirrors searcher against -host-b. Results, alerts, the
+	// breaker and metrics all follow -host alone.
+	var searcherB *BatchSearcher
+	if *hostB != "" {
+		optsB := opts
+		optsB.TypeControl, optsB.Breaker, optsB.Metrics, optsB.OnResult = nil, nil, nil, nil
+		optsB.DiscardHits = true
+		if searcherB, err = NewBatchSearcher(*hostB, auth, optsB); err != nil {
+			fmt.Printf("Invalid request options: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if *singleQuery != "" {
+		var conflicts bool
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "queries-file", "locations-file", "locations-format", "stream", "interactive", "compare-against-exact", "host-b":
+				conflicts = true
+			}
+		})
+		if conflicts {
+			fmt.Println("-query cannot be combined with -queries-file, -locations-file, -locations-format, -stream, -interactive, -compare-against-exact or -host-b")
+			os.Exit(2)
+		}
+		if err := searcher.RunQuery(context.Background(), indexNames[0], *singleQuery, os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	if err := json.Unmarshal(data, &queries); err != nil {
-		fmt.Printf("Failed to parse JSON from %s: %v\n", queriesFile, err)
+	if *interactive {
+		if *compareFile != "" || *hostB != "" {
+			fmt.Println("-interactive cannot be combined with -compare-against-exact or -host-b")
+			os.Exit(2)
+		}
+		if !*noPreflight {
+			if err := searcher.preflight(context.Background(), indexNames[:1]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		if err := searcher.RunInteractive(context.Background(), indexNames[0], os.Stdin, os.Stdout); err != nil {
+			fatalf("failed to read queries: %v", err)
+		}
 		return
 	}
 
-	allQueries := make([]string, 0, len(queries)*(*iterations))
-	for i := 0; i < *iterations; i++ {
-		for _, query := range queries {
-			queryJSON, err := json.Marshal(query)
-			if err != nil {
-				log.Printf("Failed to serialize query: %v", err)
-				continue
+	if *compareFile != "" {
+		expected, err := loadExpectedResults(*compareFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if !*noPreflight {
+			if err := searcher.preflight(context.Background(), indexNames); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
 			}
-			allQueries = append(allQueries, string(queryJSON))
 		}
+
+		passed, err := searcher.RunExpectedResults(context.Background(), indexNames[0], expected, *concurrency)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if !passed {
+			os.Exit(1)
+		}
+		return
 	}
 
-	ctx := context.Background()
-	searcher := NewBatchSearcher(*host, *username, *password)
-	successCount, failureCount, results := searcher.RunBatchSearch(ctx, *index, allQueries, *concurrency)
+	if *maxQueryBytes < 0 {
+		fmt.Println("-max-query-bytes must not be negative")
+		os.Exit(2)
+	}
+	if err := validateLocationsFormat(*locationsFormatFlag); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	genOpts := GeneratorOptions{LocationsFile: *locationsFile, LocationsFormat: *locationsFormatFlag, MaxQueryBytes: *maxQueryBytes}
+	if _, _, err := parseDistance(*distance); err != nil {
+		fmt.Printf("Invalid -distance: %v\n", err)
+		os.Exit(2)
+	}
+	genOpts.Distance = *distance
+	genOpts.PhraseField = *phraseField
+	genOpts.Seed = *seed
+	if *boolClauses < 1 {
+		fmt.Println("-bool-clauses must be at least 1")
+		os.Exit(2)
+	}
+	genOpts.BoolClauses = *boolClauses
+	if *conjuncts < 1 {
+		fmt.Println("-conjuncts must be at least 1")
+		os.Exit(2)
+	}
+	genOpts.Conjuncts = *conjuncts
+	if *polygonVertices < 3 {
+		fmt.Println("-polygon-vertices must be at least 3")
+		os.Exit(2)
+	}
+	genOpts.PolygonVertices = *polygonVertices
+	if *size < 0 || *from < 0 {
+		fmt.Println("-size and -from must not be negative")
+		os.Exit(2)
+	}
+	genOpts.Size, genOpts.From = *size, *from
+	genOpts.Fields = splitList(*fields)
+	if *sortSpec != "" {
+		genOpts.Sort, err = parseSort(*sortSpec)
+		if err != nil {
+			fmt.Printf("Invalid -sort: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *distanceRangeSpec != "" {
+		genOpts.DistanceRange, err = parseDistanceRange(*distanceRangeSpec)
+		if err != nil {
+			fmt.Printf("Invalid -distance-range: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *numRangeSpec != "" {
+		genOpts.NumericRange, err = parseNumericRange(*numRangeSpec)
+		if err != nil {
+			fmt.Printf("Invalid -num-range: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *dateRangeSpec != "" {
+		genOpts.DateRange, err = parseDateRange(*dateRangeSpec)
+		if err != nil {
+			fmt.Printf("Invalid -date-range: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *mixSpec != "" {
+		genOpts.Mix, err = parseMix(*mixSpec)
+		if err != nil {
+			fmt.Printf("Invalid -mix: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := genOpts.validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if *responseTimeGoal < 0 || *goalWindows < 1 || *goalMaxBatches < 1 {
+		fmt.Println("-response-time-goal must not be negative and -goal-windows and -goal-max-batches must be at least 1")
+		os.Exit(2)
+	}
+	if err := validateDispatchOrder(*dispatchOrder); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if *shuffle {
+		if *dispatchOrder != orderSequential && *dispatchOrder != orderRandom {
+			fmt.Printf("-shuffle cannot be combined with -dispatch-order %s\n", *dispatchOrder)
+			os.Exit(2)
+		}
+		*dispatchOrder = orderRandom
+	}
+	if *dispatchOrder != orderSequential && *stream {
+		fmt.Println("-dispatch-order cannot be combined with -stream")
+		os.Exit(2)
+	}
+	if *warmup < 0 {
+		fmt.Println("-warmup must not be negative")
+		os.Exit(2)
+	}
+	if *warmup > 0 && *stream {
+		fmt.Println("-warmup cannot be combined with -stream")
+		os.Exit(2)
+	}
+	if *dryRun && *stream {
+		fmt.Println("-dry-run cannot be combined with -stream")
+		os.Exit(2)
+	}
+	if (*estimate || *confirmRun) && *stream {
+		fmt.Println("-estimate and -confirm cannot be combined with -stream")
+		os.Exit(2)
+	}
+	if *seedRotation && (*stream || *responseTimeGoal > 0) {
+		fmt.Println("-seed-rotation cannot be combined with -stream or -response-time-goal")
+		os.Exit(2)
+	}
+	if *sample <= 0 || *sample > 1 {
+		fmt.Println("-sample must be greater than 0 and at most 1")
+		os.Exit(2)
+	}
+	if *sample < 1 && (*stream || *seedRotation) {
+		fmt.Println("-sample cannot be combined with -stream or -seed-rotation")
+		os.Exit(2)
+	}
+	if *dedup && *stream {
+		fmt.Println("-dedup cannot be combined with -stream")
+		os.Exit(2)
+	}
+	if *responseTimeGoal > 0 && *stream {
+		fmt.Println("-response-time-goal cannot be combined with -stream")
+		os.Exit(2)
+	}
+	if *queriesFile == queriesFromStdin && *confirmRun {
+		fmt.Println("-confirm reads its answer from stdin and cannot be combined with -queries-file -")
+		os.Exit(2)
+	}
+	if *duration < 0 {
+		fmt.Println("-duration must not be negative")
+		os.Exit(2)
+	}
+	if *deadline < 0 {
+		fmt.Println("-deadline must not be negative")
+		os.Exit(2)
+	}
+	if *bucketWidth < 0 {
+		fmt.Println("-bucket must not be negative")
+		os.Exit(2)
+	}
+	if *topSlow < 0 {
+		fmt.Println("-top-slow must not be negative")
+		os.Exit(2)
+	}
+	var baseline map[int]baselineResult
+	if *baselineFile != "" {
+		if *outputFormat != formatJSON || *compareFile != "" {
+			fmt.Println("-baseline needs the hits kept by -output-format json and cannot be combined with -compare-against-exact")
+			os.Exit(2)
+		}
+		baseline, err = loadBaseline(*baselineFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	var stages []loadStage
+	if *stagesFile != "" {
+		if *stream || *responseTimeGoal > 0 || *seedRotation || *duration > 0 || *rps > 0 || *estimate || *confirmRun {
+			fmt.Println("-stages cannot be combined with -stream, -response-time-goal, -seed-rotation, -duration, -rps, -estimate or -confirm")
+			os.Exit(2)
+		}
+		stages, err = loadStages(*stagesFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if *duration > 0 && (*stream || *responseTimeGoal > 0 || *seedRotation || *estimate || *confirmRun) {
+		fmt.Println("-duration cannot be combined with -stream, -response-time-goal, -seed-rotation, -estimate or -confirm")
+		os.Exit(2)
+	}
+
+	orderSeed := *seed
+	if orderSeed == 0 {
+		orderSeed = time.Now().UnixNano()
+	}
+	if *dispatchOrder == orderRandom {
+		fmt.Printf("Dispatch order seed: %d\n", orderSeed)
+	}
+	rng := rand.New(rand.NewSource(orderSeed))
 
+	// loadQueries loads the file-based query set, without duplicates if
+	// -dedup is set, narrowed by -sample.
+	loadQueries := func() []BatchQuery {
+		queries, err := loadBatchQueries(*queriesFile, *numQueries, genOpts, *validate)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if *dedup {
+			var dropped int
+			queries, dropped = dedupQueries(queries)
+			fmt.Printf("Dropped %d duplicate queries, %d left\n", dropped, len(queries))
+		}
+		if *sample < 1 {
+			sampled, indexes := sampleQueries(queries, *sample, *sampleSeed)
+			fmt.Printf("Sampled %d of %d queries (seed %d): %s\n", len(sampled), len(queries), *sampleSeed, formatIndexes(indexes))
+			queries = sampled
+		}
+		return queries
+	}
+
+	var (
+		total int64
+		run   func() (int64, int64, []QueryResult)
+		// resultsB holds the results from -host-b, if set.
+		resultsB []QueryResult
+		// planned and repeats describe the run for -estimate and -confirm.
+		planned []BatchQuery
+		repeats = 1
+	)
+
+	switch {
+	case *stream:
+		source, err := StreamQueries(ctx, *numQueries**iterations, genOpts)
+		if err != nil {
+			fmt.Printf("Failed to generate queries: %v\n", err)
+			os.Exit(1)
+		}
+		// Approximate, since generation may drop queries.
+		total = int64(*numQueries / 3 * 3 * *iterations)
+		run = func() (int64, int64, []QueryResult) {
+			return searcher.RunStreamSearch(ctx, indexNames, source, *concurrency)
+		}
+	case *responseTimeGoal > 0:
+		// Each batch runs the query set once; -iterations does not apply.
+		allQueries := loadQueries()
+		allQueries = orderQueries(allQueries, *dispatchOrder, rng)
+		goal := stabilityGoal{Tolerance: *responseTimeGoal, Windows: *goalWindows, MaxBatches: *goalMaxBatches}
+		// An upper bound; the run usually converges sooner.
+		total = int64(len(allQueries) * *goalMaxBatches)
+		planned, repeats = allQueries, *goalMaxBatches
+		run = func() (int64, int64, []QueryResult) {
+			return searcher.RunUntilStable(ctx, indexNames, allQueries, *concurrency, goal)
+		}
+	case *seedRotation:
+		allQueries, seeds, err := GenerateRotatedQueries(*numQueries, *iterations, genOpts.seed(), genOpts)
+		if err != nil {
+			fmt.Printf("Failed to generate queries: %v\n", err)
+			os.Exit(1)
+		}
+		for i, seed := range seeds {
+			fmt.Printf("Iteration %d seed: %d\n", i+1, seed)
+		}
+		allQueries = orderQueries(allQueries, *dispatchOrder, rng)
+		total = int64(len(allQueries))
+		planned = allQueries
+		run = func() (int64, int64, []QueryResult) {
+			return searcher.RunBatchSearch(ctx, indexNames, allQueries, *concurrency)
+		}
+	case len(stages) > 0:
+		// -iterations does not apply; the set is cycled through every stage.
+		allQueries := orderQueries(loadQueries(), *dispatchOrder, rng)
+		planned = allQueries
+		run = func() (int64, int64, []QueryResult) {
+			return searcher.RunStages(ctx, indexNames, allQueries, *concurrency, stages)
+		}
+	case *duration > 0:
+		// -iterations does not apply; the set is cycled until the deadline.
+		allQueries := orderQueries(loadQueries(), *dispatchOrder, rng)
+		planned = allQueries
+		run = func() (int64, int64, []QueryResult) {
+			runCtx, stop := context.WithTimeout(ctx, *duration)
+			defer stop()
+			start := time.Now()
+			successCount, failureCount, results := searcher.RunStreamSearch(runCtx, indexNames, cycleQueries(runCtx, allQueries), *concurrency)
+			fmt.Printf("Executed %d queries in %v\n", successCount+failureCount, time.Since(start).Round(time.Millisecond))
+			return successCount, failureCount, results
+		}
+	default:
+		allQueries := repeatQueries(loadQueries(), *iterations)
+		allQueries = orderQueries(allQueries, *dispatchOrder, rng)
+		total = int64(len(allQueries))
+		planned = allQueries
+		run = func() (int64, int64, []QueryResult) {
+			if searcherB != nil {
+				successCount, failureCount, results, fromB := runAB(ctx, searcher, searcherB, indexNames, allQueries, *concurrency)
+				resultsB = fromB
+				return successCount, failureCount, results
+			}
+			return searcher.RunBatchSearch(ctx, indexNames, allQueries, *concurrency)
+		}
+	}
+
+	if *dryRun {
+		searcher.printDryRun(os.Stdout, os.Stderr, indexNames, repeatQueries(planned, repeats))
+		return
+	}
+
+	if *estimate || *confirmRun {
+		hosts := 1
+		if searcherB != nil {
+			hosts = 2
+		}
+		load := estimateLoad{Concurrency: *concurrency, Latency: *estimateLatency, RPS: *rps, Think: think, Hosts: hosts}
+		estimateRun(planned, repeats, load).print(*estimateLatency)
+		if *estimate {
+			return
+		}
+		if !confirm(os.Stdin, "Proceed with the run?") {
+			fmt.Println("Aborted")
+			os.Exit(1)
+		}
+	}
+
+	// The deadline starts once any -confirm prompt is answered. run and the
+	// other closures above read ctx when called, so they see the deadline.
+	if *deadline > 0 {
+		var stopDeadline context.CancelFunc
+		ctx, stopDeadline = context.WithTimeout(ctx, *deadline)
+		defer stopDeadline()
+	}
+
+	if !*noPreflight {
+		if err := searcher.preflight(ctx, indexNames); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if searcherB != nil {
+			if err := searcherB.preflight(ctx, indexNames); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	interrupted := stopOnInterrupt(searcher, searcherB)
+
+	if streamResults {
+		streamed, err = newResultWriter(*outputFormat, resultsFileName(*outputFormat), transform)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *sqliteFile != "" {
+		if sqliteOut, err = newSQLiteWriter(*sqliteFile, runID); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	searcher.Warmup(ctx, indexNames, planned, *warmup, *concurrency)
+	if searcherB != nil {
+		searcherB.Warmup(ctx, indexNames, planned, *warmup, *concurrency)
+	}
+
+	stopProgress := func() {}
+	if *progressBar {
+		stopProgress = startProgressBar(total, searcher.Completed)
+	} else if *progress {
+		stopProgress = startProgressLine(total, searcher.Completed, searcher.Failed)
+	}
+	stopCPUProfile := func() error { return nil }
+	if *cpuProfile != "" {
+		stopCPUProfile, err = startCPUProfile(*cpuProfile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	runStart := time.Now()
+	successCount, failureCount, results := run()
+	elapsed := time.Since(runStart)
+	stopProgress()
+	if err := stopCPUProfile(); err != nil {
+		fatalf("%v", err)
+	}
+
+	if interrupted() {
+		fmt.Println("Run interrupted; the summary and results cover only the queries that were sent")
+	}
+
+	exitCode := 0
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmt.Printf("Deadline of %v reached (-deadline); in-flight queries were cancelled and %d queries executed\n", *deadline, successCount+failureCount)
+		exitCode = 1
+	}
+	if failureLimitHit {
+		fmt.Printf("Aborted early: more than %d queries failed (-max-failures); %d queries executed\n", *maxFailures, successCount+failureCount)
+		exitCode = 1
+	}
+	if alertTrigger != nil {
+		fmt.Printf("Error rate alert: %v, above the %.1f%% threshold; run aborted\n", alertTrigger, *errorRateAlert*100)
+		printFailureSummary(results)
+	}
+
+	if *region != "" {
+		fmt.Printf("Region: %s\n", *region)
+	}
 	fmt.Printf("Successful: %d\n", successCount)
 	fmt.Printf("Failed: %d\n", failureCount)
+	printThroughput(successCount, failureCount, elapsed)
+	if alertTrigger == nil {
+		printFailureSummary(results)
+	}
+	printLatencyStats("Latency", successLatencies(results))
+	printLatencyStats("TTFB", successTTFBs(results))
+	if *traceTiming {
+		printConnTiming(results)
+	}
+	printLatencyStats("Server took", successTooks(results))
+	printTypeBreakdown(results)
+	if len(stages) > 0 {
+		printStageBreakdown(results, stages)
+	}
+	buckets := timeBuckets(results, runStart, *bucketWidth)
+	printTimeBuckets(buckets, *bucketWidth)
+	printBytes(results)
+	if *topSlow > 0 {
+		printSlowest(results, *topSlow)
+	}
+	if len(indexNames) > 1 {
+		printIndexBreakdown(results)
+	}
+	if searcherB != nil {
+		printABComparison(*host, *hostB, results, resultsB)
+	}
+	if *maxQueryBytes > 0 {
+		refused := 0
+		for _, result := range results {
+			if errors.Is(result.Error, errQueryTooLarge) {
+				refused++
+			}
+		}
+		fmt.Printf("Refused (over %d bytes): %d\n", *maxQueryBytes, refused)
+	}
+
+	if control != nil {
+		control.printReport()
+	}
+	if breaker != nil {
+		breaker.printReport()
+	}
+	if budget != nil {
+		budget.printReport()
+	}
+	printHeaderDistributions(results, searcher.headerNames)
+	// A run cut short by an alert, -max-failures or an interrupt is not
+	// repeated; ctx or the searcher has already been stopped.
+	if *repeatFailed && ctx.Err() == nil && !interrupted() {
+		searcher.RepeatFailed(ctx, indexNames, results, *concurrency)
+	}
 
-	if *printResults {
-		resultsFile := "results.json"
-		file, err := os.Create(resultsFile)
+	if baseline != nil && !printBaselineComparison(*baselineFile, baseline, results) {
+		exitCode = 1
+	}
+	if len(slas) > 0 && !printSLAReport(computeSLACompliance(results, slas), *slaTarget) {
+		exitCode = 1
+	}
+	if executed := successCount + failureCount; executed > 0 && float64(failureCount)/float64(executed) > *maxFailureRate {
+		fmt.Printf("Failure rate %.2f%% is above -max-failure-rate %.2f%%\n", 100*float64(failureCount)/float64(executed), *maxFailureRate*100)
+		exitCode = 1
+	}
+	if *assertZeroFailures && failureCount > 0 {
+		fmt.Printf("Assertion failed: %d queries failed\n", failureCount)
+		exitCode = 1
+	}
+
+	if *summaryFile != "" {
+		summary := summarizeRun(successCount, failureCount, results, elapsed)
+		summary.BucketSeconds, summary.Buckets = bucketWidth.Seconds(), buckets
+		summary.Region = *region
+		if err := writeSummary(*summaryFile, summary); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("Summary written to %s\n", *summaryFile)
+	}
+
+	if streamed != nil {
+		if err := streamed.close(); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("Results written to %s\n", resultsFileName(*outputFormat))
+	} else if *printResults {
+		resultsFile := resultsFileName(*outputFormat)
+		if err := writeResults(resultsFile, results, transform); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("Results written to %s\n", resultsFile)
+	}
+
+	if *failedQueriesFile != "" {
+		n, err := writeFailedQueries(*failedQueriesFile, results)
 		if err != nil {
-			log.Fatalf("Failed to create results file: %v\n", err)
+			fatalf("%v", err)
 		}
-		defer file.Close()
-	
-		// Structure to hold all results for writing to file
-		type ResultOutput struct {
-			Query   QueryResult `json:"query_result"`
-			Success bool        `json:"success"`
+		if n > 0 {
+			fmt.Printf("%d failed queries written to %s\n", n, *failedQueriesFile)
 		}
-	
-		var output []ResultOutput
-	
+	}
+
+	if sqliteOut != nil {
+		// Skipped queries never reach OnResult, so they are added here.
 		for _, result := range results {
-			if result.Error != nil {
-				output = append(output, ResultOutput{
-					Query:   result,
-					Success: false,
-				})
-			} else {
-				output = append(output, ResultOutput{
-					Query:   result,
-					Success: true,
-				})
+			if result.Skipped {
+				sqliteOut.write(result)
 			}
 		}
-	
-		// Write the results to the file in JSON format
-		data, err := json.MarshalIndent(output, "", "  ")
-		if err != nil {
-			log.Fatalf("Failed to serialize results: %v\n", err)
+		if err := sqliteOut.close(); err != nil {
+			fatalf("failed to write SQLite results: %v", err)
 		}
-	
-		if _, err := file.Write(data); err != nil {
-			log.Fatalf("Failed to write to results file: %v\n", err)
+		fmt.Printf("Results written to %s with run_id %s\n", *sqliteFile, runID)
+	}
+
+	if *memProfile != "" {
+		if err := writeHeapProfile(*memProfile); err != nil {
+			fatalf("%v", err)
 		}
-	
-		fmt.Printf("Results written to %s\n", resultsFile)
+		fmt.Printf("Memory profile written to %s\n", *memProfile)
+	}
+
+	if interrupted() {
+		exitCode = exitInterrupted
+	}
+	if alertTrigger != nil {
+		exitCode = exitErrorRateAlert
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
-	
-	
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// runMetrics exposes live Prometheus metrics of the measured queries sent,
+// leaving out warmup and repeated queries. Every series carries the -region
+// label, if set. A nil runMetrics records nothing.
+type runMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	inFlight prometheus.Gauge
+	latency  *prometheus.HistogramVec
+}
+
+func newRunMetrics(region string) *runMetrics {
+	var labels prometheus.Labels
+	if region != "" {
+		labels = prometheus.Labels{"region": region}
+	}
+	m := &runMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "queryrunner_queries_total",
+			Help:        "Queries sent, by query type.",
+			ConstLabels: labels,
+		}, []string{"type"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "queryrunner_query_failures_total",
+			Help:        "Failed queries, by HTTP status or, without a response, by error category.",
+			ConstLabels: labels,
+		}, []string{"status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "queryrunner_queries_in_flight",
+			Help:        "Queries currently being sent, including retries.",
+			ConstLabels: labels,
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "queryrunner_query_latency_seconds",
+			Help:        "Client-measured latency of successful queries, by query type.",
+			Buckets:     prometheus.ExponentialBuckets(0.001, 2, 16),
+			ConstLabels: labels,
+		}, []string{"type"}),
+	}
+	m.registry.MustRegister(m.requests, m.failures, m.inFlight, m.latency)
+	return m
+}
+
+// serve exposes the metrics on /metrics at addr in the background.
+func (m *runMetrics) serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("metrics endpoint stopped", "error", err)
+		}
+	}()
+}
+
+// started records a query about to be sent.
+func (m *runMetrics) started() {
+	if m != nil {
+		m.inFlight.Inc()
+	}
+}
+
+// finished records a query that started returned, unless it was cut off.
+func (m *runMetrics) finished(result QueryResult) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Dec()
+	if result.Skipped {
+		return
+	}
+	m.requests.WithLabelValues(result.Type).Inc()
+	if result.Error != nil {
+		m.failures.WithLabelValues(statusLabel(result.Error)).Inc()
+		return
+	}
+	m.latency.WithLabelValues(result.Type).Observe(result.Latency.Seconds())
+}
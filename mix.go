@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// mixEntry is the weight of one query type in a queryMix.
+type mixEntry struct {
+	Type   string
+	Weight float64
+}
+
+// queryMix weights how often each generated query type is drawn. Entries are
+// kept in generatedTypes order so a seed always draws the same sequence.
+type queryMix []mixEntry
+
+// parseMix parses a comma-separated list of type=weight pairs, such as
+// "location=70,relationship=20,conjunct=10". Types left out get no queries,
+// so this is also how types outside defaultTypes are asked for.
+// Weights are relative and need not add up to 100.
+func parseMix(spec string) (queryMix, error) {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected type=weight, got %q", pair)
+		}
+		if !isGeneratedType(name) {
+			return nil, fmt.Errorf("unknown query type %q (want one of %s)", name, strings.Join(generatedTypes, ", "))
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for %s: %v", name, err)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("weight for %s must not be negative", name)
+		}
+		weights[name] = weight
+	}
+
+	var mix queryMix
+	for _, queryType := range generatedTypes {
+		if weight := weights[queryType]; weight > 0 {
+			mix = append(mix, mixEntry{Type: queryType, Weight: weight})
+		}
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("at least one weight must be positive")
+	}
+	return mix, nil
+}
+
+func isGeneratedType(name string) bool {
+	for _, queryType := range generatedTypes {
+		if queryType == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pick draws a query type with probability proportional to its weight.
+func (m queryMix) pick(rng *rand.Rand) string {
+	var total float64
+	for _, entry := range m {
+		total += entry.Weight
+	}
+	r := rng.Float64() * total
+	for _, entry := range m {
+		if r < entry.Weight {
+			return entry.Type
+		}
+		r -= entry.Weight
+	}
+	return m[len(m)-1].Type
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// exitErrorRateAlert is the exit status used when -error-rate-alert fires,
+// distinct from ordinary failures so an orchestrator can tell them apart.
+const exitErrorRateAlert = 3
+
+type windowEntry struct {
+	failed bool
+	at     time.Time
+}
+
+// errorRateMonitor tracks the error rate over the most recent completed
+// queries and calls onBreach, once, when it first exceeds threshold over a
+// full window.
+type errorRateMonitor struct {
+	mu        sync.Mutex
+	threshold float64
+	window    []windowEntry
+	next      int
+	filled    bool
+	failures  int
+	breached  bool
+	onBreach  func(errorRateWindow)
+}
+
+// errorRateWindow describes the window that triggered an alert.
+type errorRateWindow struct {
+	Size     int
+	Failures int
+	From, To time.Time
+}
+
+func (w errorRateWindow) rate() float64 {
+	return float64(w.Failures) / float64(w.Size)
+}
+
+func newErrorRateMonitor(threshold float64, size int, onBreach func(errorRateWindow)) *errorRateMonitor {
+	return &errorRateMonitor{
+		threshold: threshold,
+		window:    make([]windowEntry, size),
+		onBreach:  onBreach,
+	}
+}
+
+// record adds a completed query to the window.
+func (m *errorRateMonitor) record(result QueryResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.filled && m.window[m.next].failed {
+		m.failures--
+	}
+	m.window[m.next] = windowEntry{failed: result.Error != nil, at: time.Now()}
+	if result.Error != nil {
+		m.failures++
+	}
+	m.next = (m.next + 1) % len(m.window)
+	if m.next == 0 {
+		m.filled = true
+	}
+
+	if !m.filled || m.breached {
+		return
+	}
+	if float64(m.failures)/float64(len(m.window)) > m.threshold {
+		m.breached = true
+		// m.next now points at the oldest entry in the window.
+		oldest := m.window[m.next]
+		newest := m.window[(m.next+len(m.window)-1)%len(m.window)]
+		m.onBreach(errorRateWindow{Size: len(m.window), Failures: m.failures, From: oldest.at, To: newest.at})
+	}
+}
+
+func (w errorRateWindow) String() string {
+	return fmt.Sprintf("%d of the last %d queries failed (%.1f%%) between %s and %s",
+		w.Failures, w.Size, w.rate()*100, w.From.Format("15:04:05.000"), w.To.Format("15:04:05.000"))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Dispatch orders accepted by -dispatch-order.
+const (
+	// orderSequential dispatches queries in the order they were loaded.
+	orderSequential = "sequential"
+	// orderRandom shuffles the queries, breaking up the regular pattern of
+	// the generated file and repeated runs of the same query.
+	orderRandom = "random"
+	// orderInterleave takes queries from each type in turn, so every type is
+	// represented steadily throughout the run.
+	orderInterleave = "interleave"
+)
+
+func validateDispatchOrder(order string) error {
+	switch order {
+	case orderSequential, orderRandom, orderInterleave:
+		return nil
+	}
+	return fmt.Errorf("unknown dispatch order %q (want %s, %s or %s)", order, orderSequential, orderRandom, orderInterleave)
+}
+
+// orderQueries returns queries rearranged into the given dispatch order. The
+// input slice is not modified.
+func orderQueries(queries []BatchQuery, order string, rng *rand.Rand) []BatchQuery {
+	ordered := make([]BatchQuery, len(queries))
+	copy(ordered, queries)
+
+	switch order {
+	case orderRandom:
+		rng.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	case orderInterleave:
+		// Group by type, keeping types in order of first appearance and each
+		// type's queries in their original order.
+		var types []string
+		byType := make(map[string][]BatchQuery)
+		for _, query := range queries {
+			if _, ok := byType[query.Type]; !ok {
+				types = append(types, query.Type)
+			}
+			byType[query.Type] = append(byType[query.Type], query)
+		}
+
+		ordered = ordered[:0]
+		for len(ordered) < len(queries) {
+			for _, queryType := range types {
+				if pending := byType[queryType]; len(pending) > 0 {
+					ordered = append(ordered, pending[0])
+					byType[queryType] = pending[1:]
+				}
+			}
+		}
+	}
+	return ordered
+}
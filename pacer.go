@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// pacer spaces query dispatches out to a steady rate. A nil pacer does not
+// limit the rate.
+type pacer struct {
+	ticker *time.Ticker
+}
+
+// newPacer returns a pacer allowing rps dispatches per second, or nil if rps
+// is not positive.
+func newPacer(rps float64) *pacer {
+	if !(rps > 0) {
+		return nil
+	}
+	return &pacer{ticker: time.NewTicker(pacerInterval(rps))}
+}
+
+// pacerInterval is the time between dispatches at rps, clamped to what a
+// ticker can take: at least 1ns for rates too high to space out, and at most
+// the longest Duration for rates so low the interval would overflow.
+func pacerInterval(rps float64) time.Duration {
+	interval := float64(time.Second) / rps
+	switch {
+	case interval < 1:
+		return 1
+	case interval >= math.MaxInt64:
+		return math.MaxInt64
+	}
+	return time.Duration(interval)
+}
+
+// wait blocks until the next dispatch is allowed, returning false if ctx is
+// cancelled first.
+func (p *pacer) wait(ctx context.Context) bool {
+	if p == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-p.ticker.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *pacer) stop() {
+	if p != nil {
+		p.ticker.Stop()
+	}
+}
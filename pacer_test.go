@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPacerInterval(t *testing.T) {
+	tests := []struct {
+		rps  float64
+		want time.Duration
+	}{
+		{1, time.Second},
+		{1000, time.Millisecond},
+		{1e9, time.Nanosecond},
+		{1e12, time.Nanosecond},
+		{math.Inf(1), time.Nanosecond},
+		{1e-12, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		if got := pacerInterval(tt.rps); got != tt.want {
+			t.Errorf("pacerInterval(%g) = %v, want %v", tt.rps, got, tt.want)
+		}
+	}
+}
+
+func TestNewPacerExtremeRates(t *testing.T) {
+	for _, rps := range []float64{1e12, math.Inf(1), 1e-12} {
+		p := newPacer(rps)
+		if p == nil {
+			t.Fatalf("newPacer(%g) = nil, want a pacer", rps)
+		}
+		p.stop()
+	}
+	for _, rps := range []float64{0, -1, math.NaN()} {
+		if p := newPacer(rps); p != nil {
+			p.stop()
+			t.Errorf("newPacer(%g) = %v, want nil", rps, p)
+		}
+	}
+}
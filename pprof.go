@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof" // registers the /debug/pprof handlers on http.DefaultServeMux
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startPprof serves the runtime profiling endpoints under /debug/pprof/ on
+// addr in the background, for profiling the runner itself during a run.
+func startPprof(addr string) {
+	go func() {
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			slog.Error("pprof endpoint stopped", "error", err)
+		}
+	}()
+}
+
+// startCPUProfile starts writing a CPU profile to path. The returned function
+// stops the profile and closes the file.
+func startCPUProfile(path string) (func() error, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CPU profile: %v", err)
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to start CPU profile: %v", err)
+	}
+	return func() error {
+		pprof.StopCPUProfile()
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write CPU profile: %v", err)
+		}
+		return nil
+	}, nil
+}
+
+// writeHeapProfile writes a heap profile to path, after a garbage collection
+// so that it reflects live memory.
+func writeHeapProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create memory profile: %v", err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write memory profile: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write memory profile: %v", err)
+	}
+	return nil
+}
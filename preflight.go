@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// preflightQuery matches nothing, so it is cheap for the server to answer.
+const preflightQuery = `{"query":{"match_none":{}},"size":0}`
+
+// preflight sends one cheap query to each index so that an unreachable host,
+// rejected credentials or a missing index are reported before the run starts
+// rather than as every query failing. Other errors only print a warning, since
+// the run's own queries may still succeed.
+func (bs *BatchSearcher) preflight(ctx context.Context, indexNames []string) error {
+	for _, indexName := range indexNames {
+		_, _, err := bs.performSearch(ctx, indexName, preflightQuery)
+		if err == nil {
+			continue
+		}
+
+		var (
+			httpErr *HTTPError
+			urlErr  *url.Error
+		)
+		switch {
+		case errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden):
+			return fmt.Errorf("preflight: %s rejected the credentials (status %d); check -user and -pass, or -token", bs.baseURL, httpErr.StatusCode)
+		case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("preflight: index %q not found at %s", indexName, bs.endpoint(indexName))
+		case errors.As(err, &httpErr):
+			fmt.Printf("Warning: preflight query against index %q failed: %v\n", indexName, err)
+		case errors.As(err, &urlErr):
+			return fmt.Errorf("preflight: cannot reach %s: %v", bs.baseURL, urlErr.Err)
+		default:
+			fmt.Printf("Warning: preflight query against index %q failed: %v\n", indexName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	progressBarWidth = 30
+	// ETA throughput is averaged over this trailing window, so the estimate
+	// follows changes in speed instead of the whole run's average.
+	progressWindow = 10 * time.Second
+)
+
+type progressSample struct {
+	at        time.Time
+	completed int64
+}
+
+// progressBar renders how far a run has got, with an estimated time
+// remaining. On a terminal it redraws a single line in place; otherwise it
+// prints a plain line every ten seconds.
+type progressBar struct {
+	out       io.Writer
+	tty       bool
+	total     int64
+	completed func() int64
+	// failed, if set, renders a plain counts line every interval instead
+	// of the bar.
+	failed  func() int64
+	samples []progressSample
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgressBar renders progress towards total on stderr until the
+// returned stop function is called. completed reports how many queries have
+// finished so far. A total of zero means the number of queries is not known
+// in advance, and only the count and rate are shown.
+func startProgressBar(total int64, completed func() int64) (stop func()) {
+	bar := &progressBar{
+		out:       os.Stderr,
+		tty:       isTerminal(os.Stderr),
+		total:     total,
+		completed: completed,
+	}
+
+	interval := 10 * time.Second
+	if bar.tty {
+		interval = 500 * time.Millisecond
+	}
+	return bar.start(interval)
+}
+
+// startProgressLine prints a line to stderr every second with how many of
+// total queries have completed, how many of them failed and the rolling
+// throughput, until the returned stop function is called.
+func startProgressLine(total int64, completed, failed func() int64) (stop func()) {
+	line := &progressBar{
+		out:       os.Stderr,
+		total:     total,
+		completed: completed,
+		failed:    failed,
+	}
+	return line.start(time.Second)
+}
+
+// start renders every interval, and once more when stopped.
+func (p *progressBar) start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		p.sample(time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				p.sample(now)
+				p.render()
+			case <-done:
+				p.sample(time.Now())
+				p.render()
+				if p.tty {
+					fmt.Fprintln(p.out)
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// sample records the completed count at now and forgets samples that have
+// fallen out of the throughput window, always keeping at least one.
+func (p *progressBar) sample(now time.Time) {
+	p.samples = append(p.samples, progressSample{at: now, completed: p.completed()})
+
+	cutoff := now.Add(-progressWindow)
+	drop := 0
+	for drop < len(p.samples)-2 && p.samples[drop+1].at.Before(cutoff) {
+		drop++
+	}
+	p.samples = p.samples[drop:]
+}
+
+// rate returns the moving-average throughput in queries per second.
+func (p *progressBar) rate() float64 {
+	first, last := p.samples[0], p.samples[len(p.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.completed-first.completed) / elapsed
+}
+
+func (p *progressBar) render() {
+	done := p.samples[len(p.samples)-1].completed
+	if p.failed != nil {
+		failed := p.failed()
+		total := "?"
+		if p.total > 0 {
+			total = fmt.Sprint(p.total)
+		}
+		fmt.Fprintf(p.out, "Progress: %d/%s completed, %d ok, %d failed, %.1f queries/s\n", done, total, done-failed, failed, p.rate())
+		return
+	}
+	if p.total <= 0 {
+		// Runs bounded by time rather than a query count, such as -duration.
+		line := fmt.Sprintf("Progress: %d completed, %.1f queries/s", done, p.rate())
+		if p.tty {
+			fmt.Fprintf(p.out, "\r%s    ", line)
+		} else {
+			fmt.Fprintln(p.out, line)
+		}
+		return
+	}
+	fraction := 0.0
+	if p.total > 0 {
+		fraction = float64(done) / float64(p.total)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	eta := "--"
+	if rate := p.rate(); rate > 0 && done < p.total {
+		remaining := time.Duration(float64(p.total-done) / rate * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	} else if done >= p.total {
+		eta = "0s"
+	}
+
+	if !p.tty {
+		fmt.Fprintf(p.out, "Progress: %d/%d (%.1f%%), ETA %s\n", done, p.total, fraction*100, eta)
+		return
+	}
+
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	// Trailing spaces clear what is left of a longer previous line.
+	fmt.Fprintf(p.out, "\r[%s] %5.1f%% %d/%d ETA %s    ", bar, fraction*100, done, p.total, eta)
+}
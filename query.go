@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -17,16 +22,71 @@ type Root struct {
 		} `json:"geometry"`
 		Relationship string `json:"relationship"`
 	} `json:"bklctrcb"`
+
+	fields map[string]interface{}
+}
+
+// UnmarshalJSON also keeps every field of the location, so generated queries
+// can draw on fields beyond the ones Root names.
+func (r *Root) UnmarshalJSON(data []byte) error {
+	type plain Root
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &r.fields)
+}
+
+// lookup returns the field at a dotted path such as "bklctrcb.address.city"
+// as text, or the empty string if the location has no such field.
+func (r Root) lookup(path string) string {
+	var value interface{} = r.fields
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
 }
 
 type LocationQuery struct {
 	Query struct {
 		Location struct {
-			Lon      float64 `json:"lon"`
-			Lat      float64 `json:"lat"`
+			Lon float64 `json:"lon"`
+			Lat float64 `json:"lat"`
 		} `json:"location"`
-		Distance string  `json:"distance"`
-		Field    string  `json:"field"`
+		Distance string `json:"distance"`
+		Field    string `json:"field"`
+	} `json:"query"`
+}
+
+// geoPoint is a point in the {"lon": ..., "lat": ...} form FTS geo queries
+// accept.
+type geoPoint struct {
+	Lon float64 `json:"lon"`
+	Lat float64 `json:"lat"`
+}
+
+type GeoBoundingBoxQuery struct {
+	Query struct {
+		TopLeft     geoPoint `json:"top_left"`
+		BottomRight geoPoint `json:"bottom_right"`
+		Field       string   `json:"field"`
+	} `json:"query"`
+}
+
+type GeoPolygonQuery struct {
+	Query struct {
+		PolygonPoints []geoPoint `json:"polygon_points"`
+		Field         string     `json:"field"`
 	} `json:"query"`
 }
 
@@ -37,89 +97,495 @@ type RelationshipQuery struct {
 	} `json:"query"`
 }
 
+type MatchPhraseQuery struct {
+	Query struct {
+		MatchPhrase string `json:"match_phrase"`
+		Field       string `json:"field"`
+	} `json:"query"`
+}
+
+type NumericRangeQuery struct {
+	Query struct {
+		Min   float64 `json:"min"`
+		Max   float64 `json:"max"`
+		Field string  `json:"field"`
+	} `json:"query"`
+}
+
+type DateRangeQuery struct {
+	Query struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+		Field string `json:"field"`
+	} `json:"query"`
+}
+
+type ConjunctClauses struct {
+	Conjuncts []interface{} `json:"conjuncts"`
+}
+
+type DisjunctClauses struct {
+	Disjuncts []interface{} `json:"disjuncts"`
+	Min       int           `json:"min,omitempty"`
+}
+
+type BooleanQuery struct {
+	Query struct {
+		Must    *ConjunctClauses `json:"must,omitempty"`
+		Should  *DisjunctClauses `json:"should,omitempty"`
+		MustNot *DisjunctClauses `json:"must_not,omitempty"`
+	} `json:"query"`
+}
+
 type ConjunctQuery struct {
 	Query struct {
 		Conjuncts []interface{} `json:"conjuncts"`
 	} `json:"query"`
 }
 
-// Function to generate queries
-func makeQueries(locations []Root, n int) []interface{} {
+// Query types, as named in reports.
+const (
+	typeLocation     = "location"
+	typeRelationship = "relationship"
+	typeConjunct     = "conjunct"
+	typeMatchPhrase  = "match_phrase"
+	typeNumericRange = "numeric_range"
+	typeDateRange    = "date_range"
+	typeBoolean      = "boolean"
+	typeBoundingBox  = "bounding_box"
+	typePolygon      = "polygon"
+	typeOther        = "other"
+)
+
+// queryType identifies which of the generated shapes a query has, so queries
+// loaded from a file can be grouped by type just like freshly generated ones.
+func queryType(query map[string]interface{}) string {
+	switch {
+	case query["conjuncts"] != nil:
+		return typeConjunct
+	case query["must"] != nil || query["should"] != nil || query["must_not"] != nil:
+		return typeBoolean
+	case query["location"] != nil:
+		return typeLocation
+	case query["top_left"] != nil || query["bottom_right"] != nil:
+		return typeBoundingBox
+	case query["polygon_points"] != nil:
+		return typePolygon
+	case query["match"] != nil:
+		return typeRelationship
+	case query["match_phrase"] != nil:
+		return typeMatchPhrase
+	case query["min"] != nil || query["max"] != nil:
+		return typeNumericRange
+	case query["start"] != nil || query["end"] != nil:
+		return typeDateRange
+	}
+	return typeOther
+}
+
+// defaultPhraseField is the location field match_phrase queries use.
+const defaultPhraseField = "bklctrcb.address.line1"
+
+func (o GeneratorOptions) phraseField() string {
+	if o.PhraseField != "" {
+		return o.PhraseField
+	}
+	return defaultPhraseField
+}
+
+// defaultLocationsFile is read for locations when no other file is given.
+const defaultLocationsFile = "long-lat.json"
+
+// GeneratorOptions controls how queries are generated.
+type GeneratorOptions struct {
+	// LocationsFile holds the locations queries are generated from. Empty
+	// means defaultLocationsFile.
+	LocationsFile string
+	// LocationsFormat is the format of LocationsFile, json or csv. Empty
+	// means csv for a .csv file and json otherwise.
+	LocationsFormat string
+	// Mix, if set, draws each generated query's type by weight instead of
+	// generating the same number of every type.
+	Mix queryMix
+	// Distance is the radius of generated location searches, such as "100mi".
+	// Empty means defaultDistance.
+	Distance string
+	// DistanceRange, if set, gives each location search a random radius
+	// within it instead of Distance.
+	DistanceRange *distanceRange
+	// PhraseField is the dotted path of the location field that match_phrase
+	// queries search for, and search in. Empty means defaultPhraseField.
+	PhraseField string
+	// NumericRange and DateRange are the fields and spans that numeric_range
+	// and date_range queries pick their bounds from. A mix can only ask for
+	// those types when they are set.
+	NumericRange *numericRange
+	DateRange    *dateRange
+	// BoolClauses is how many location and relationship clauses each boolean
+	// query spreads across must, should and must_not. Zero means
+	// defaultBoolClauses.
+	BoolClauses int
+	// Conjuncts is how many location and relationship clauses each conjunct
+	// query ANDs together. Zero means defaultConjuncts.
+	Conjuncts int
+	// PolygonVertices is how many vertices each polygon query has. Zero means
+	// defaultPolygonVertices.
+	PolygonVertices int
+	// Size and From set the page of hits every generated query asks for.
+	// Zero leaves the field out, so the server's default applies.
+	Size int
+	From int
+	// Fields names the stored fields every generated query asks to be
+	// returned with each hit. Empty leaves fields out.
+	Fields []string
+	// Sort, if set, is the sort every generated query asks for.
+	Sort []sortKey
+	// Seed makes generation reproducible: the same seed and options always
+	// generate the same queries. Zero means a time-based seed.
+	Seed int64
+	// MaxQueryBytes drops generated queries whose serialized form is larger
+	// than this many bytes. Zero means no limit.
+	MaxQueryBytes int
+}
+
+// seed returns the seed generation should use.
+func (o GeneratorOptions) seed() int64 {
+	if o.Seed != 0 {
+		return o.Seed
+	}
+	return time.Now().UnixNano()
+}
+
+// validate checks that every type the mix asks for can be generated.
+func (o GeneratorOptions) validate() error {
+	for _, entry := range o.Mix {
+		switch {
+		case entry.Type == typeNumericRange && o.NumericRange == nil:
+			return errors.New("-mix includes numeric_range queries, which need -num-range")
+		case entry.Type == typeDateRange && o.DateRange == nil:
+			return errors.New("-mix includes date_range queries, which need -date-range")
+		}
+	}
+	return nil
+}
+
+// generates reports whether queries of queryType can be generated: any of
+// defaultTypes without a mix, or those the mix names.
+func (o GeneratorOptions) generates(queryType string) bool {
+	types := defaultTypes
+	if o.Mix != nil {
+		types = nil
+		for _, entry := range o.Mix {
+			types = append(types, entry.Type)
+		}
+	}
+	for _, t := range types {
+		if t == queryType {
+			return true
+		}
+	}
+	return false
+}
+
+// tooLarge reports whether a serialized query exceeds MaxQueryBytes.
+func (o GeneratorOptions) tooLarge(queryJSON []byte) bool {
+	return o.MaxQueryBytes > 0 && len(queryJSON) > o.MaxQueryBytes
+}
+
+// Function to generate queries. It also returns how many generated queries
+// were dropped for exceeding opts.MaxQueryBytes.
+func makeQueries(locations []Root, n int, rng *rand.Rand, opts GeneratorOptions) ([]interface{}, int) {
 	queries := make([]interface{}, 0, n*3) // Pre-allocate space for n queries of each type
+	dropped := 0
+
+	emitQueries(locations, n, rng, opts, func(_ string, query interface{}) bool {
+		if opts.MaxQueryBytes > 0 {
+			queryJSON, err := json.Marshal(query)
+			if err == nil && opts.tooLarge(queryJSON) {
+				dropped++
+				return true
+			}
+		}
+		queries = append(queries, query)
+		return true
+	})
+
+	return queries, dropped
+}
+
+// defaultTypes are the query types generated for each location, in this
+// order, when no mix is set.
+var defaultTypes = []string{typeLocation, typeRelationship, typeConjunct}
+
+// generatedTypes are all the query types the generator can make; those not in
+// defaultTypes are only generated when a mix asks for them.
+var generatedTypes = []string{typeLocation, typeRelationship, typeConjunct, typeMatchPhrase, typeNumericRange, typeDateRange, typeBoolean, typeBoundingBox, typePolygon}
+
+// emitQueries generates n queries of each type, passing each one to emit
+// together with its type as soon as it is made. With a mix, the same total
+// is generated but each query's type is drawn by weight. Generation stops
+// early if emit returns false.
+func emitQueries(locations []Root, n int, rng *rand.Rand, opts GeneratorOptions, emit func(queryType string, query interface{}) bool) {
+	if opts.Mix != nil {
+		for i := 0; i < n*len(defaultTypes); i++ {
+			queryType := opts.Mix.pick(rng)
+			loc := locations[rng.Intn(len(locations))]
+			if !emit(queryType, opts.request(opts.buildQuery(queryType, loc, locations, rng), loc)) {
+				return
+			}
+		}
+		return
+	}
 
 	for i := 0; i < n; i++ {
 		// Select random location for each iteration
-		randomLoc := locations[rand.Intn(len(locations))]
-		coords := randomLoc.Bklctrcb.Geometry.Coordinates
-		relationship := randomLoc.Bklctrcb.Relationship
+		randomLoc := locations[rng.Intn(len(locations))]
+		for _, queryType := range defaultTypes {
+			if !emit(queryType, opts.request(opts.buildQuery(queryType, randomLoc, locations, rng), randomLoc)) {
+				return
+			}
+		}
+	}
+}
 
-		// Generate location query
+// buildQuery makes a query of the given generated type for loc. Types made of
+// several clauses draw the further locations they need from locations.
+func (o GeneratorOptions) buildQuery(queryType string, loc Root, locations []Root, rng *rand.Rand) interface{} {
+	coords := loc.Bklctrcb.Geometry.Coordinates
+	relationship := loc.Bklctrcb.Relationship
+
+	switch queryType {
+	case typeLocation:
 		locQuery := LocationQuery{}
 		locQuery.Query.Location.Lon = coords[0] // Correct field access for Lon
 		locQuery.Query.Location.Lat = coords[1] // Correct field access for Lat
-		locQuery.Query.Distance = "100mi"
+		locQuery.Query.Distance = o.distance(rng)
 		locQuery.Query.Field = "bklctrcb.geometry.coordinates" // Correct field access for Field
-		queries = append(queries, locQuery)
+		return locQuery
 
-		// Generate relationship query
+	case typeRelationship:
 		relationshipQuery := RelationshipQuery{}
 		relationshipQuery.Query.Match = relationship
 		relationshipQuery.Query.Field = "bklctrcb.relationship"
-		queries = append(queries, relationshipQuery)
-
-		// Generate conjunct query
-		conjunctQuery := ConjunctQuery{}
-		conjunctQuery.Query.Conjuncts = []interface{}{
-			map[string]interface{}{
-				"location": map[string]interface{}{
-					"lon": coords[0],
-					"lat": coords[1],
-				},
-				"distance": "100mi",
-				"field":    "bklctrcb.geometry.coordinates",
-			},
-			map[string]interface{}{
-				"match": relationship,
-				"field": "bklctrcb.relationship",
-			},
-		}
-		queries = append(queries, conjunctQuery)
+		return relationshipQuery
+
+	case typeMatchPhrase:
+		phraseQuery := MatchPhraseQuery{}
+		phraseQuery.Query.MatchPhrase = loc.lookup(o.phraseField())
+		phraseQuery.Query.Field = o.phraseField()
+		return phraseQuery
+
+	case typeNumericRange:
+		rangeQuery := NumericRangeQuery{}
+		rangeQuery.Query.Min, rangeQuery.Query.Max = o.NumericRange.bounds(rng)
+		rangeQuery.Query.Field = o.NumericRange.Field
+		return rangeQuery
+
+	case typeDateRange:
+		rangeQuery := DateRangeQuery{}
+		rangeQuery.Query.Start, rangeQuery.Query.End = o.DateRange.bounds(rng)
+		rangeQuery.Query.Field = o.DateRange.Field
+		return rangeQuery
+
+	case typeConjunct:
+		return o.conjunctQuery(loc, locations, rng)
+
+	case typeBoolean:
+		return o.booleanQuery(loc, locations, rng)
+
+	case typeBoundingBox:
+		return o.boundingBoxQuery(loc, rng)
+
+	case typePolygon:
+		return o.polygonQuery(loc, locations)
 	}
+	panic("unknown generated query type " + queryType)
+}
 
-	return queries
+// locationClause is a location search around loc, for use inside compound
+// queries.
+func (o GeneratorOptions) locationClause(loc Root, rng *rand.Rand) map[string]interface{} {
+	coords := loc.Bklctrcb.Geometry.Coordinates
+	return map[string]interface{}{
+		"location": map[string]interface{}{
+			"lon": coords[0],
+			"lat": coords[1],
+		},
+		"distance": o.distance(rng),
+		"field":    "bklctrcb.geometry.coordinates",
+	}
 }
 
-func GenerateQueries(n int) {
-	// Read JSON file containing locations
-	data, err := os.ReadFile("long-lat.json")
+// relationshipClause is a match on the relationship of loc, for use inside
+// compound queries.
+func relationshipClause(loc Root) map[string]interface{} {
+	return map[string]interface{}{
+		"match": loc.Bklctrcb.Relationship,
+		"field": "bklctrcb.relationship",
+	}
+}
+
+// locations reads the locations that queries are generated from.
+func (o GeneratorOptions) locations() ([]Root, error) {
+	path := o.LocationsFile
+	if path == "" {
+		path = defaultLocationsFile
+	}
+	locations, err := loadLocations(path, o.LocationsFormat)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if o.generates(typeConjunct) {
+		if n, found := conjunctLocations(o.conjuncts()), distinctLocations(locations); found < n {
+			return nil, fmt.Errorf("conjunct queries with %d clauses need at least %d distinct locations in %s, found %d", o.conjuncts(), n, path, found)
+		}
+	}
+	if o.generates(typePolygon) {
+		if n, found := o.polygonVertices(), distinctPoints(locations); found < n {
+			return nil, fmt.Errorf("polygon queries with %d vertices need at least %d distinct points in %s, found %d", n, n, path, found)
+		}
+	}
+	return locations, nil
+}
+
+// loadLocations reads the locations that queries are generated from, in the
+// given format, as resolved by locationsFormat. Entries without at least a
+// longitude and latitude are skipped, and coordinates out of range are kept,
+// with a warning for each kind.
+func loadLocations(path, format string) ([]Root, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("locations file %s does not exist", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locations file: %v", err)
 	}
 
-	// Parse JSON into locations slice
 	var locations []Root
-	if err := json.Unmarshal(data, &locations); err != nil {
-		panic(err)
+	if locationsFormat(path, format) == locationsCSV {
+		if locations, err = parseCSVLocations(data); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV from %s: %v", path, err)
+		}
+	} else if err := json.Unmarshal(data, &locations); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %v", path, err)
+	}
+	locations = checkCoordinates(path, locations)
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("no locations found in %s", path)
+	}
+	return locations, nil
+}
+
+// GenerateQueries generates n queries and writes them to queriesFile.
+func GenerateQueries(n int, queriesFile string, opts GeneratorOptions) error {
+	// Read JSON file containing locations
+	locations, err := opts.locations()
+	if err != nil {
+		return err
 	}
 
 	// Seed random number generator
-	rand.Seed(time.Now().UnixNano())
+	seed := opts.seed()
+	fmt.Printf("Generating queries with seed %d\n", seed)
+	rng := rand.New(rand.NewSource(seed))
 
 	// Generate random queries
-	queries := makeQueries(locations, n/3)
+	queries, dropped := makeQueries(locations, n/3, rng, opts)
+	if dropped > 0 {
+		fmt.Printf("Dropped %d generated queries larger than %d bytes\n", dropped, opts.MaxQueryBytes)
+	}
 
 	// Marshal the queries into JSON format with indentation
 	queryJSON, err := json.MarshalIndent(queries, "", "    ")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to serialize queries: %v", err)
 	}
 
 	// Write the JSON queries to a file
-	err = os.WriteFile("queries.json", queryJSON, 0644)
-	if err != nil {
-		panic(err)
+	if err := os.WriteFile(queriesFile, queryJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", queriesFile, err)
 	}
 
 	// Print success message
-	fmt.Println("Queries saved to queries.json")
+	fmt.Printf("Queries saved to %s\n", queriesFile)
+	return nil
+}
+
+// emitBatchQueries generates n queries serialized for dispatch, passing each
+// one to send. It stops early if send returns false and returns how many
+// queries were dropped for exceeding opts.MaxQueryBytes.
+func emitBatchQueries(locations []Root, n int, rng *rand.Rand, opts GeneratorOptions, send func(BatchQuery) bool) int {
+	dropped := 0
+	emitQueries(locations, n/3, rng, opts, func(queryType string, query interface{}) bool {
+		queryJSON, err := json.Marshal(query)
+		if err != nil {
+			slog.Error("failed to serialize query", "error", err)
+			return true
+		}
+		if opts.tooLarge(queryJSON) {
+			dropped++
+			return true
+		}
+		return send(BatchQuery{Type: queryType, Body: string(queryJSON)})
+	})
+	return dropped
+}
+
+// StreamQueries generates n queries like GenerateQueries, but instead of
+// writing them to a file it sends each one on the returned channel as
+// soon as it is made. The channel is closed once all queries have been sent or
+// ctx is cancelled.
+func StreamQueries(ctx context.Context, n int, opts GeneratorOptions) (<-chan BatchQuery, error) {
+	locations, err := opts.locations()
+	if err != nil {
+		return nil, err
+	}
+	seed := opts.seed()
+	fmt.Printf("Generating queries with seed %d\n", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	queries := make(chan BatchQuery)
+	go func() {
+		defer close(queries)
+
+		dropped := emitBatchQueries(locations, n, rng, opts, func(query BatchQuery) bool {
+			select {
+			case queries <- query:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if dropped > 0 {
+			fmt.Printf("Dropped %d generated queries larger than %d bytes\n", dropped, opts.MaxQueryBytes)
+		}
+	}()
+	return queries, nil
+}
+
+// GenerateRotatedQueries generates a fresh set of n queries for each of
+// iterations instead of repeating one set, so every iteration exercises
+// different data. Iteration i is seeded with baseSeed+i; the seeds are
+// returned so any iteration can be reproduced.
+func GenerateRotatedQueries(n, iterations int, baseSeed int64, opts GeneratorOptions) ([]BatchQuery, []int64, error) {
+	locations, err := opts.locations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	queries := make([]BatchQuery, 0, n/3*3*iterations)
+	seeds := make([]int64, 0, iterations)
+	dropped := 0
+	for i := 0; i < iterations; i++ {
+		seed := baseSeed + int64(i)
+		seeds = append(seeds, seed)
+		dropped += emitBatchQueries(locations, n, rand.New(rand.NewSource(seed)), opts, func(query BatchQuery) bool {
+			queries = append(queries, query)
+			return true
+		})
+	}
+	if dropped > 0 {
+		fmt.Printf("Dropped %d generated queries larger than %d bytes\n", dropped, opts.MaxQueryBytes)
+	}
+	return queries, seeds, nil
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// rampDelays returns when each of workers workers should start, spread evenly
+// over the ramp-up so that the effective concurrency grows linearly from 1.
+// Only the first measured run ramps up: later batches of the same run, such
+// as those of -response-time-goal, start at full concurrency. It returns nil
+// when there is nothing to ramp.
+func (bs *BatchSearcher) rampDelays(workers int, measured bool) []time.Duration {
+	if bs.rampUp <= 0 || !measured || bs.rampedUp {
+		return nil
+	}
+	bs.rampedUp = true
+	delays := make([]time.Duration, workers)
+	for w := range delays {
+		delays[w] = bs.rampUp * time.Duration(w) / time.Duration(workers)
+	}
+	return delays
+}
+
+// waitToStart holds a worker back for delay, returning early if ctx is
+// cancelled or the searcher is stopped.
+func (bs *BatchSearcher) waitToStart(ctx context.Context, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-bs.stop:
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDateRange is searched by generated date_range queries.
+const defaultDateRange = "bklctrcb.openDate=2015-01-01..2025-01-01"
+
+// numericRange is a field and the span generated numeric_range queries pick
+// their bounds from.
+type numericRange struct {
+	Field    string
+	Min, Max float64
+}
+
+// dateRange is a field and the span generated date_range queries pick their
+// bounds from. Bounds are formatted with Layout, the layout the span was
+// given in.
+type dateRange struct {
+	Field      string
+	Start, End time.Time
+	Layout     string
+}
+
+// splitRange splits a range spec of the form field=low..high.
+func splitRange(spec string) (field, low, high string, err error) {
+	field, bounds, ok := strings.Cut(spec, "=")
+	if !ok || field == "" {
+		return "", "", "", fmt.Errorf("expected field=low..high, got %q", spec)
+	}
+	low, high, ok = strings.Cut(bounds, "..")
+	if !ok {
+		return "", "", "", fmt.Errorf("expected field=low..high, got %q", spec)
+	}
+	return field, low, high, nil
+}
+
+// parseNumericRange parses a range such as "price=0..500".
+func parseNumericRange(spec string) (*numericRange, error) {
+	field, low, high, err := splitRange(spec)
+	if err != nil {
+		return nil, err
+	}
+	minValue, err := strconv.ParseFloat(low, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum %q", low)
+	}
+	maxValue, err := strconv.ParseFloat(high, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maximum %q", high)
+	}
+	if minValue > maxValue {
+		return nil, errors.New("minimum is above maximum")
+	}
+	return &numericRange{Field: field, Min: minValue, Max: maxValue}, nil
+}
+
+// parseDateRange parses a range such as "openDate=2015-01-01..2025-01-01".
+// Dates may also be given as RFC 3339 timestamps.
+func parseDateRange(spec string) (*dateRange, error) {
+	field, low, high, err := splitRange(spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		start, startErr := time.Parse(layout, low)
+		end, endErr := time.Parse(layout, high)
+		if startErr != nil || endErr != nil {
+			continue
+		}
+		if start.After(end) {
+			return nil, errors.New("start is after end")
+		}
+		return &dateRange{Field: field, Start: start, End: end, Layout: layout}, nil
+	}
+	return nil, fmt.Errorf("dates in %q must both be YYYY-MM-DD or RFC 3339", spec)
+}
+
+// bounds draws a random sub-range, rounded to two decimal places.
+func (r numericRange) bounds(rng *rand.Rand) (float64, float64) {
+	a := r.Min + rng.Float64()*(r.Max-r.Min)
+	b := r.Min + rng.Float64()*(r.Max-r.Min)
+	values := []float64{math.Round(a*100) / 100, math.Round(b*100) / 100}
+	sort.Float64s(values)
+	return values[0], values[1]
+}
+
+// bounds draws a random sub-range, in whole days for date-only ranges.
+func (r dateRange) bounds(rng *rand.Rand) (string, string) {
+	span := r.End.Sub(r.Start)
+	unit := time.Second
+	if r.Layout == time.DateOnly {
+		unit = 24 * time.Hour
+	}
+	pick := func() time.Time {
+		steps := int64(span / unit)
+		return r.Start.Add(time.Duration(rng.Int63n(steps+1)) * unit)
+	}
+	a, b := pick(), pick()
+	if a.After(b) {
+		a, b = b, a
+	}
+	return a.Format(r.Layout), b.Format(r.Layout)
+}
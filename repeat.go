@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// failedQueries returns the queries of the failed results, in run order.
+func failedQueries(results []QueryResult) []BatchQuery {
+	var queries []BatchQuery
+	for _, result := range results {
+		if result.Error != nil {
+			queries = append(queries, BatchQuery{Type: result.Type, Body: result.Query})
+		}
+	}
+	return queries
+}
+
+// RepeatFailed runs the queries that failed in results once more and prints
+// how many of them recovered, which separates transient failures from
+// queries that fail every time. Like Warmup, the second pass is not passed to
+// OnResult, counted by Completed or recorded in the metrics, so the run's own
+// results are unchanged.
+func (bs *BatchSearcher) RepeatFailed(ctx context.Context, indexNames []string, results []QueryResult, batchSize int) {
+	queries := failedQueries(results)
+	if len(queries) == 0 {
+		return
+	}
+	recovered, failed, _ := bs.runStream(ctx, indexNames, queryChannel(ctx, queries), batchSize, false)
+	fmt.Printf("Repeated %d failed queries: %d recovered, %d failed again\n", len(queries), recovered, failed)
+}
+
+// writeFailedQueries writes the failed queries of results to path in the
+// format of the queries file, so they can be replayed with -queries-file. If
+// no query failed, it removes any file a previous run left at path, so stale
+// failures are not replayed, and returns 0.
+func writeFailedQueries(path string, results []QueryResult) (int, error) {
+	queries := failedQueries(results)
+	if len(queries) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("failed to remove stale %s: %v", path, err)
+		}
+		return 0, nil
+	}
+
+	bodies := make([]json.RawMessage, len(queries))
+	for i, query := range queries {
+		bodies[i] = json.RawMessage(query.Body)
+	}
+	data, err := json.MarshalIndent(bodies, "", "    ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize failed queries: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return len(queries), nil
+}
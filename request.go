@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// searchRequest is a generated query with the request settings that sit next
+// to it in the top-level object added: the size and from of the page of hits
+// to return, the stored fields to return with them and how to sort them. Unset
+// settings are left out, so the server's defaults apply.
+type searchRequest struct {
+	query      interface{}
+	size, from int
+	fields     []string
+	sort       []sortKey
+	// origin is the point a geo_distance sort is measured from.
+	origin geoPoint
+}
+
+func (r searchRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.query)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if r.size > 0 {
+		object["size"] = json.RawMessage(strconv.Itoa(r.size))
+	}
+	if r.from > 0 {
+		object["from"] = json.RawMessage(strconv.Itoa(r.from))
+	}
+	if len(r.fields) > 0 {
+		fields, err := json.Marshal(r.fields)
+		if err != nil {
+			return nil, err
+		}
+		object["fields"] = fields
+	}
+	if len(r.sort) > 0 {
+		values := make([]interface{}, len(r.sort))
+		for i, key := range r.sort {
+			values[i] = key.sortValue(r.origin)
+		}
+		sort, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		object["sort"] = sort
+	}
+	return json.Marshal(object)
+}
+
+// request adds the configured request settings, if any, to query, which was
+// generated from loc.
+func (o GeneratorOptions) request(query interface{}, loc Root) interface{} {
+	if o.Size == 0 && o.From == 0 && len(o.Fields) == 0 && len(o.Sort) == 0 {
+		return query
+	}
+	return searchRequest{query: query, size: o.Size, from: o.From, fields: o.Fields, sort: o.Sort, origin: pointOf(loc)}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Formats accepted by -output-format.
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+// csvFlushEvery is how many CSV rows are buffered before they are flushed.
+const csvFlushEvery = 100
+
+// validateOutputFormat checks a -output-format value.
+func validateOutputFormat(format string) error {
+	switch format {
+	case formatJSON, formatNDJSON, formatCSV:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (want %s, %s or %s)", format, formatJSON, formatNDJSON, formatCSV)
+}
+
+// resultsFileName is where results are written in the given format.
+func resultsFileName(format string) string {
+	return "results." + format
+}
+
+// resultWriter writes results to the results file one at a time, as they
+// complete. write is meant to be called from SearcherOptions.OnResult, which is
+// never called concurrently.
+type resultWriter interface {
+	write(result QueryResult)
+	// close flushes and closes the file, returning the first error seen.
+	close() error
+}
+
+// newResultWriter returns a resultWriter for the streamed format.
+func newResultWriter(format, path string, transform resultTransform) (resultWriter, error) {
+	if format == formatCSV {
+		return newCSVWriter(path)
+	}
+	return newNDJSONWriter(path, transform)
+}
+
+// ndjsonWriter writes each result to a file as one line of JSON as soon as
+// it completes, so results need not be held in memory until the run ends.
+type ndjsonWriter struct {
+	file      *os.File
+	buf       *bufio.Writer
+	enc       *json.Encoder
+	transform resultTransform
+	// err is the first write error; later results are not written.
+	err error
+}
+
+func newNDJSONWriter(path string, transform resultTransform) (*ndjsonWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create results file: %v", err)
+	}
+	buf := bufio.NewWriter(file)
+	return &ndjsonWriter{file: file, buf: buf, enc: json.NewEncoder(buf), transform: transform}, nil
+}
+
+func (w *ndjsonWriter) write(result QueryResult) {
+	if w.err != nil {
+		return
+	}
+	entry, err := newResultOutput(result, w.transform)
+	if err == nil {
+		err = w.enc.Encode(entry)
+	}
+	if err != nil {
+		w.err = fmt.Errorf("failed to write result %d: %v", result.QueryIndex, err)
+	}
+}
+
+func (w *ndjsonWriter) close() error {
+	if err := w.buf.Flush(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to write to results file: %v", err)
+	}
+	if err := w.file.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to write to results file: %v", err)
+	}
+	return w.err
+}
+
+// csvHeader names the columns written by csvWriter.
+var csvHeader = []string{"query_index", "type", "index", "success", "status", "total_hits", "hit_count", "took_ms", "client_latency_ms", "error", "region"}
+
+// csvWriter writes one flat row per result, for spreadsheets. Hits are
+// summarized by their count. Like every resultWriter, it is only given the
+// queries that were sent; skipped ones never reach OnResult.
+type csvWriter struct {
+	file *os.File
+	csv  *csv.Writer
+	rows int
+	err  error
+}
+
+func newCSVWriter(path string) (*csvWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create results file: %v", err)
+	}
+	w := &csvWriter{file: file, csv: csv.NewWriter(file)}
+	if err := w.csv.Write(csvHeader); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write to results file: %v", err)
+	}
+	return w, nil
+}
+
+func (w *csvWriter) write(result QueryResult) {
+	if w.err != nil {
+		return
+	}
+	row := []string{
+		strconv.Itoa(result.QueryIndex),
+		result.Type,
+		result.IndexName,
+		strconv.FormatBool(result.Error == nil),
+		"success", "", "", "",
+		strconv.FormatFloat(float64(result.Latency)/float64(time.Millisecond), 'f', 3, 64),
+		"",
+		result.Region,
+	}
+	if result.Error != nil {
+		row[4] = "failure"
+		row[9] = result.Error.Error()
+	} else {
+		row[5] = strconv.Itoa(result.Result.Total)
+		row[6] = strconv.Itoa(len(result.Result.Hits))
+		// FTS reports took in nanoseconds.
+		row[7] = strconv.FormatFloat(float64(result.Result.Took)/1e6, 'f', 3, 64)
+	}
+
+	if err := w.csv.Write(row); err != nil {
+		w.err = fmt.Errorf("failed to write result %d: %v", result.QueryIndex, err)
+		return
+	}
+	w.rows++
+	if w.rows%csvFlushEvery == 0 {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			w.err = fmt.Errorf("failed to write to results file: %v", err)
+		}
+	}
+}
+
+func (w *csvWriter) close() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to write to results file: %v", err)
+	}
+	if err := w.file.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to write to results file: %v", err)
+	}
+	return w.err
+}
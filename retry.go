@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxRetryBackoff caps the exponential backoff between attempts.
+	maxRetryBackoff = 30 * time.Second
+	// maxRetryAfterWaits caps how many times one query honors Retry-After
+	// without using up a retry, so a server that always answers 429 cannot
+	// hold a worker forever.
+	maxRetryAfterWaits = 10
+)
+
+// searchWithRetry runs performSearch, retrying transient failures up to
+// bs.retries times with exponential backoff and jitter. A 429 response with a
+// valid Retry-After header is waited out as the server asks and does not use
+// up a retry. Every retry of either kind is drawn from bs.retryBudget. It
+// also returns how many attempts were made. The byte counts of the returned
+// responseInfo cover every attempt.
+func (bs *BatchSearcher) searchWithRetry(ctx context.Context, indexName, query string) (*SearchResult, responseInfo, int, error) {
+	retriesLeft, retryAfterWaits := bs.retries, 0
+	var sent, received int64
+	for attempt := 1; ; attempt++ {
+		result, info, err := bs.performSearch(ctx, indexName, query)
+		sent += info.BytesSent
+		received += info.BytesReceived
+		info.BytesSent, info.BytesReceived = sent, received
+		if err == nil {
+			return result, info, attempt, nil
+		}
+
+		exhausted := false
+		if bs.retries > 0 && retryAfterWaits < maxRetryAfterWaits && ctx.Err() == nil {
+			if wait, ok := retryAfter(err, time.Now()); ok {
+				if exhausted = !bs.retryBudget.take(); !exhausted {
+					retryAfterWaits++
+					if sleepContext(ctx, wait) {
+						continue
+					}
+				}
+			}
+		}
+
+		if retriesLeft == 0 || !isRetryable(ctx, err) || exhausted || !bs.retryBudget.take() ||
+			!sleepContext(ctx, bs.backoff(bs.retries-retriesLeft+1)) {
+			if bs.retries > 0 {
+				plural := "s"
+				if attempt == 1 {
+					plural = ""
+				}
+				err = fmt.Errorf("failed after %d attempt%s: %w", attempt, plural, err)
+			}
+			return nil, info, attempt, err
+		}
+		retriesLeft--
+	}
+}
+
+// retryBudget caps the retries of a whole run, across every worker, so that
+// retrying against a degraded cluster cannot multiply the load it was
+// offered. A nil retryBudget allows every retry.
+type retryBudget struct {
+	limit   int64
+	used    int64
+	refused int64
+}
+
+func newRetryBudget(limit int64) *retryBudget {
+	return &retryBudget{limit: limit}
+}
+
+// take uses up one retry, reporting false once the budget is exhausted.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	if atomic.AddInt64(&b.used, 1) > b.limit {
+		atomic.AddInt64(&b.used, -1)
+		atomic.AddInt64(&b.refused, 1)
+		return false
+	}
+	return true
+}
+
+// printReport prints how much of the budget was used, and how many failed
+// queries were not retried once it ran out.
+func (b *retryBudget) printReport() {
+	used, refused := atomic.LoadInt64(&b.used), atomic.LoadInt64(&b.refused)
+	fmt.Printf("Retry budget: %d of %d retries used", used, b.limit)
+	if refused > 0 {
+		fmt.Printf("; exhausted, %d failures not retried", refused)
+	}
+	fmt.Println()
+}
+
+// retryAfter returns how long a 429 response asked to wait via its
+// Retry-After header, which may hold either a number of seconds or an HTTP
+// date. It reports false if err is not such a response or the header is
+// missing or malformed.
+func retryAfter(err error, now time.Time) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusTooManyRequests || httpErr.RetryAfter == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(httpErr.RetryAfter); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(httpErr.RetryAfter); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isRetryable reports whether err is worth retrying: connection errors and
+// 5xx or 429 responses are, while other 4xx responses, oversized queries and
+// unparseable responses would only fail the same way again.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// backoff returns how long to wait after the given failed attempt: the base
+// backoff doubled for every earlier attempt, with the upper half jittered so
+// that workers retrying together spread out.
+func (bs *BatchSearcher) backoff(attempt int) time.Duration {
+	delay := bs.retryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// sleepContext waits for d, returning false early if ctx is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
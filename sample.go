@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// sampleQueries picks roughly fraction of queries. A query is included when a
+// hash of seed, its index and its body falls below fraction, so the same seed
+// and input always select the same subset. It returns the sampled queries
+// and their indexes in queries.
+func sampleQueries(queries []BatchQuery, fraction float64, seed int64) ([]BatchQuery, []int) {
+	var (
+		sampled []BatchQuery
+		indexes []int
+		buf     [16]byte
+	)
+	for i, query := range queries {
+		h := fnv.New64a()
+		binary.LittleEndian.PutUint64(buf[:8], uint64(seed))
+		binary.LittleEndian.PutUint64(buf[8:], uint64(i))
+		h.Write(buf[:])
+		h.Write([]byte(query.Body))
+
+		// The top 53 bits of the hash, as a uniform value in [0, 1).
+		if float64(h.Sum64()>>11)/(1<<53) < fraction {
+			sampled = append(sampled, query)
+			indexes = append(indexes, i)
+		}
+	}
+	return sampled, indexes
+}
+
+// formatIndexes renders indexes as a comma-separated list.
+func formatIndexes(indexes []int) string {
+	parts := make([]string, len(indexes))
+	for i, index := range indexes {
+		parts[i] = strconv.Itoa(index)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// exitInterrupted is the exit status of a run stopped by SIGINT or SIGTERM,
+// following the shell convention of 128 plus SIGINT.
+const exitInterrupted = 130
+
+// stopOnInterrupt makes the first SIGINT or SIGTERM stop the searchers, any
+// of which may be nil, from dispatching further queries, so the run drains
+// and its partial results and summary are still written. A second signal
+// exits immediately. The returned function reports whether the run was
+// interrupted.
+func stopOnInterrupt(searchers ...*BatchSearcher) (interrupted func() bool) {
+	var received atomic.Bool
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		received.Store(true)
+		slog.Warn("interrupted; waiting for in-flight queries to finish (interrupt again to exit now)")
+		for _, searcher := range searchers {
+			if searcher != nil {
+				searcher.Stop()
+			}
+		}
+
+		<-signals
+		slog.Warn("interrupted again; exiting without writing results")
+		os.Exit(exitInterrupted)
+	}()
+	return received.Load
+}
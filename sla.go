@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// parseLatencySLAs parses a comma-separated list of type=duration pairs, such
+// as "location=1s,relationship=200ms", into per-type latency thresholds.
+func parseLatencySLAs(spec string) (map[string]time.Duration, error) {
+	slas := make(map[string]time.Duration)
+	if strings.TrimSpace(spec) == "" {
+		return slas, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected type=duration, got %q", pair)
+		}
+		threshold, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for %s: %v", name, err)
+		}
+		if threshold <= 0 {
+			return nil, fmt.Errorf("duration for %s must be positive", name)
+		}
+		slas[name] = threshold
+	}
+	return slas, nil
+}
+
+// slaCompliance is how many queries of one type finished within its SLA.
+type slaCompliance struct {
+	Type      string
+	Threshold time.Duration
+	Total     int
+	Met       int
+}
+
+func (c slaCompliance) percent() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return 100 * float64(c.Met) / float64(c.Total)
+}
+
+// computeSLACompliance tallies, for every type with an SLA, how many of its
+// queries succeeded within the threshold. Failed queries never meet the SLA;
+// skipped queries are left out.
+func computeSLACompliance(results []QueryResult, slas map[string]time.Duration) []slaCompliance {
+	byType := make(map[string]*slaCompliance, len(slas))
+	for name, threshold := range slas {
+		byType[name] = &slaCompliance{Type: name, Threshold: threshold}
+	}
+
+	for _, result := range results {
+		c, ok := byType[result.Type]
+		if !ok || result.Skipped {
+			continue
+		}
+		c.Total++
+		if result.Error == nil && result.Latency <= c.Threshold {
+			c.Met++
+		}
+	}
+
+	report := make([]slaCompliance, 0, len(byType))
+	for _, c := range byType {
+		report = append(report, *c)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Type < report[j].Type })
+	return report
+}
+
+// printSLAReport prints the compliance of every type and reports whether all
+// types with queries reached target percent compliance.
+func printSLAReport(report []slaCompliance, target float64) bool {
+	ok := true
+	fmt.Println("Latency SLA compliance:")
+	for _, c := range report {
+		if c.Total == 0 {
+			fmt.Printf("  %s (<= %v): no queries\n", c.Type, c.Threshold)
+			continue
+		}
+		status := "PASS"
+		if c.percent() < target {
+			status = "FAIL"
+			ok = false
+		}
+		fmt.Printf("  %s (<= %v): %d/%d met, %.2f%% (target %.2f%%) %s\n", c.Type, c.Threshold, c.Met, c.Total, c.percent(), target, status)
+	}
+	return ok
+}
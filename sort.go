@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sortByGeoDistance is the -sort key that sorts hits by their distance from
+// the location each query was generated from.
+const sortByGeoDistance = "geo_distance"
+
+// sortKey is one key of the sort generated queries ask for.
+type sortKey struct {
+	// Field is the field to sort by, such as _score, or sortByGeoDistance.
+	Field string
+	Desc  bool
+}
+
+// parseSort parses a comma-separated list of sort keys, each a field name
+// such as _score or bklctrcb.relationship, or geo_distance, and prefixed with
+// - to sort in descending order.
+func parseSort(spec string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		key := sortKey{Field: strings.TrimPrefix(item, "-"), Desc: strings.HasPrefix(item, "-")}
+		if key.Field == "" {
+			return nil, fmt.Errorf("empty sort key in %q", spec)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortValue is the FTS sort array element for key, with origin as the point
+// geo_distance is measured from.
+func (key sortKey) sortValue(origin geoPoint) interface{} {
+	if key.Field == sortByGeoDistance {
+		value := map[string]interface{}{
+			"by":       "geo_distance",
+			"field":    "bklctrcb.geometry.coordinates",
+			"location": origin,
+		}
+		if key.Desc {
+			value["desc"] = true
+		}
+		return value
+	}
+	if key.Desc {
+		return "-" + key.Field
+	}
+	return key.Field
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const createResultsTable = `CREATE TABLE IF NOT EXISTS results (
+	run_id      TEXT    NOT NULL,
+	region      TEXT    NOT NULL,
+	query_index INTEGER NOT NULL,
+	type        TEXT    NOT NULL,
+	status      TEXT    NOT NULL,
+	latency_ms  REAL    NOT NULL,
+	total_hits  INTEGER,
+	took_ms     REAL,
+	error       TEXT
+)`
+
+// sqliteCommitEvery is how many rows are inserted per transaction, so a run
+// that crashes loses at most this many.
+const sqliteCommitEvery = 1000
+
+// sqliteWriter inserts one row per result into the results table of a SQLite
+// database as each query completes, tagged with the run's ID. The table is
+// created if it does not exist, so results from many runs can be collected in
+// one database. Like resultWriter, it is meant to be fed from OnResult.
+type sqliteWriter struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	stmt  *sql.Stmt
+	runID string
+	rows  int
+	// err is the first error; later results are not inserted.
+	err error
+}
+
+func newSQLiteWriter(path, runID string) (*sqliteWriter, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	if _, err := db.Exec(createResultsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create results table: %v", err)
+	}
+	w := &sqliteWriter{db: db, runID: runID}
+	if err := w.begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// begin starts the transaction the next rows are inserted in.
+func (w *sqliteWriter) begin() error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO results
+		(run_id, region, query_index, type, status, latency_ms, total_hits, took_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare insert: %v", err)
+	}
+	w.tx, w.stmt = tx, stmt
+	return nil
+}
+
+// commit commits the rows inserted since begin.
+func (w *sqliteWriter) commit() error {
+	w.stmt.Close()
+	if err := w.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit results: %v", err)
+	}
+	return nil
+}
+
+func (w *sqliteWriter) write(result QueryResult) {
+	if w.err != nil {
+		return
+	}
+	var (
+		status    = "success"
+		totalHits sql.NullInt64
+		tookMs    sql.NullFloat64
+		errText   sql.NullString
+	)
+	switch {
+	case result.Skipped:
+		status = "skipped"
+	case result.Error != nil:
+		status = "failure"
+		errText = sql.NullString{String: result.Error.Error(), Valid: true}
+	default:
+		totalHits = sql.NullInt64{Int64: int64(result.Result.Total), Valid: true}
+		// FTS reports took in nanoseconds.
+		tookMs = sql.NullFloat64{Float64: float64(result.Result.Took) / 1e6, Valid: true}
+	}
+
+	latencyMs := float64(result.Latency) / float64(time.Millisecond)
+	if _, err := w.stmt.Exec(w.runID, result.Region, result.QueryIndex, result.Type, status, latencyMs, totalHits, tookMs, errText); err != nil {
+		w.err = fmt.Errorf("failed to insert result %d: %v", result.QueryIndex, err)
+		return
+	}
+	w.rows++
+	if w.rows%sqliteCommitEvery == 0 {
+		if w.err = w.commit(); w.err == nil {
+			w.err = w.begin()
+		}
+	}
+}
+
+// close commits the remaining rows and closes the database, returning the
+// first error seen.
+func (w *sqliteWriter) close() error {
+	if w.err == nil {
+		w.err = w.commit()
+	} else if w.tx != nil {
+		w.tx.Rollback()
+	}
+	if err := w.db.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to close database: %v", err)
+	}
+	return w.err
+}
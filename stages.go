@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// loadStage is one step of a staged load profile: dispatch at RPS queries
+// per second for Duration. An RPS of zero means no rate limit.
+type loadStage struct {
+	RPS      float64
+	Duration time.Duration
+}
+
+// UnmarshalJSON reads a stage written as {"rps": 10, "duration": "1m"}.
+func (s *loadStage) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		RPS      float64 `json:"rps"`
+		Duration string  `json:"duration"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(raw.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", raw.Duration, err)
+	}
+	s.RPS, s.Duration = raw.RPS, d
+	return nil
+}
+
+func (s loadStage) String() string {
+	if s.RPS == 0 {
+		return fmt.Sprintf("unlimited rps for %v", s.Duration)
+	}
+	return fmt.Sprintf("%v rps for %v", s.RPS, s.Duration)
+}
+
+// loadStages reads the ordered list of stages in path.
+func loadStages(path string) ([]loadStage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var stages []loadStage
+	if err := json.Unmarshal(data, &stages); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %v", path, err)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("%s lists no stages", path)
+	}
+	for i, stage := range stages {
+		if stage.Duration <= 0 {
+			return nil, fmt.Errorf("stage %d in %s: duration must be positive", i+1, path)
+		}
+		if stage.RPS < 0 {
+			return nil, fmt.Errorf("stage %d in %s: rps must not be negative", i+1, path)
+		}
+	}
+	return stages, nil
+}
+
+// RunStages runs each stage in turn, cycling through queries at the stage's
+// rate until its duration is up. Queries in flight when a stage ends are
+// cancelled and skipped, so no stage runs past its duration. Each result
+// records its 1-based stage, and results from all stages are returned
+// together, indexed in run order.
+func (bs *BatchSearcher) RunStages(ctx context.Context, indexNames []string, queries []BatchQuery, batchSize int, stages []loadStage) (int64, int64, []QueryResult) {
+	var (
+		successCount int64
+		failureCount int64
+		results      []QueryResult
+	)
+	defer func(rps float64) { bs.rps = rps }(bs.rps)
+
+	for i, stage := range stages {
+		if ctx.Err() != nil || bs.stopping() {
+			fmt.Printf("Stopped after %d stages (%d queries)\n", i, len(results))
+			break
+		}
+		fmt.Printf("Stage %d: %v\n", i+1, stage)
+		bs.rps = stage.RPS
+		stageCtx, cancel := context.WithTimeout(ctx, stage.Duration)
+		success, failure, stageResults := bs.RunStreamSearch(stageCtx, indexNames, cycleQueries(stageCtx, queries), batchSize)
+		cancel()
+		successCount += success
+		failureCount += failure
+		for _, result := range stageResults {
+			result.QueryIndex += len(results)
+			result.Stage = i + 1
+			results = append(results, result)
+		}
+	}
+	return successCount, failureCount, results
+}
+
+// printStageBreakdown prints, for each stage, how many queries were sent, the
+// rate they were sent at, what share failed and the mean and p95 latency of
+// the successful ones. Skipped queries are left out.
+func printStageBreakdown(results []QueryResult, stages []loadStage) {
+	byStage := make([][]QueryResult, len(stages))
+	for _, result := range results {
+		if !result.Skipped && result.Stage > 0 && result.Stage <= len(stages) {
+			byStage[result.Stage-1] = append(byStage[result.Stage-1], result)
+		}
+	}
+
+	fmt.Println("By stage:")
+	for i, stageResults := range byStage {
+		if len(stageResults) == 0 {
+			fmt.Printf("  %d (%v): no queries\n", i+1, stages[i])
+			continue
+		}
+		latencies := successLatencies(stageResults)
+		failed := 100 * float64(len(stageResults)-len(latencies)) / float64(len(stageResults))
+		rate := float64(len(stageResults)) / stages[i].Duration.Seconds()
+		stats, ok := computeLatencyStats(latencies)
+		if !ok {
+			fmt.Printf("  %d (%v): %d queries at %.1f/s, %.1f%% failed, latency n/a\n", i+1, stages[i], len(stageResults), rate, failed)
+			continue
+		}
+		fmt.Printf("  %d (%v): %d queries at %.1f/s, %.1f%% failed, mean %v, p95 %v\n", i+1, stages[i], len(stageResults), rate, failed, stats.Mean, stats.P95)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// percentile returns the p-th percentile (0 < p <= 100) of sorted using the
+// nearest-rank method. sorted must be non-empty and in ascending order.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// latencyStats summarizes a set of latencies.
+type latencyStats struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// computeLatencyStats summarizes sorted, which must be in ascending order.
+// It reports false if there are no latencies to summarize.
+func computeLatencyStats(sorted []time.Duration) (latencyStats, bool) {
+	if len(sorted) == 0 {
+		return latencyStats{}, false
+	}
+
+	var sum time.Duration
+	for _, latency := range sorted {
+		sum += latency
+	}
+	return latencyStats{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Max:   sorted[len(sorted)-1],
+		Mean:  sum / time.Duration(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		P99:   percentile(sorted, 99),
+	}, true
+}
+
+// printLatencyStats prints the summary of sorted under label, or n/a if
+// there is nothing to summarize.
+func printLatencyStats(label string, sorted []time.Duration) {
+	stats, ok := computeLatencyStats(sorted)
+	if !ok {
+		fmt.Printf("%s: n/a\n", label)
+		return
+	}
+	fmt.Printf("%s: min %v, mean %v, max %v, p50 %v, p95 %v, p99 %v\n",
+		label, stats.Min, stats.Mean, stats.Max, stats.P50, stats.P95, stats.P99)
+}
+
+// successLatencies returns the latencies of the successful results in
+// ascending order.
+func successLatencies(results []QueryResult) []time.Duration {
+	latencies := make([]time.Duration, 0, len(results))
+	for _, result := range results {
+		if result.Error == nil && !result.Skipped {
+			latencies = append(latencies, result.Latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies
+}
+
+// successTTFBs returns the times to first byte of the successful results in
+// ascending order.
+func successTTFBs(results []QueryResult) []time.Duration {
+	ttfbs := make([]time.Duration, 0, len(results))
+	for _, result := range results {
+		if result.Error == nil && !result.Skipped {
+			ttfbs = append(ttfbs, result.TTFB)
+		}
+	}
+	sort.Slice(ttfbs, func(i, j int) bool { return ttfbs[i] < ttfbs[j] })
+	return ttfbs
+}
+
+// successTooks returns the server-reported search times of the successful
+// results in ascending order.
+func successTooks(results []QueryResult) []time.Duration {
+	tooks := make([]time.Duration, 0, len(results))
+	for _, result := range results {
+		if result.Error == nil && !result.Skipped && result.Result != nil {
+			tooks = append(tooks, time.Duration(result.Result.Took))
+		}
+	}
+	sort.Slice(tooks, func(i, j int) bool { return tooks[i] < tooks[j] })
+	return tooks
+}
+
+// printTypeBreakdown prints, for each query type, how many queries were sent,
+// what share of them succeeded and the mean and p95 latency of the successful
+// ones. Skipped queries are left out.
+func printTypeBreakdown(results []QueryResult) {
+	byType := make(map[string][]QueryResult)
+	for _, result := range results {
+		if !result.Skipped {
+			byType[result.Type] = append(byType[result.Type], result)
+		}
+	}
+	if len(byType) == 0 {
+		return
+	}
+
+	types := make([]string, 0, len(byType))
+	for queryType := range byType {
+		types = append(types, queryType)
+	}
+	sort.Strings(types)
+
+	fmt.Println("By type:")
+	for _, queryType := range types {
+		typeResults := byType[queryType]
+		latencies := successLatencies(typeResults)
+		succeeded := 100 * float64(len(latencies)) / float64(len(typeResults))
+		stats, ok := computeLatencyStats(latencies)
+		if !ok {
+			fmt.Printf("  %s: %d queries, %.1f%% succeeded, latency n/a\n", queryType, len(typeResults), succeeded)
+			continue
+		}
+		fmt.Printf("  %s: %d queries, %.1f%% succeeded, mean %v, p95 %v\n", queryType, len(typeResults), succeeded, stats.Mean, stats.P95)
+	}
+}
+
+// printIndexBreakdown prints, for each index queries were spread across, how
+// many of its queries succeeded and failed and the mean and p95 latency of the
+// successful ones. Skipped queries are left out.
+func printIndexBreakdown(results []QueryResult) {
+	byIndex := make(map[string][]QueryResult)
+	for _, result := range results {
+		if !result.Skipped {
+			byIndex[result.IndexName] = append(byIndex[result.IndexName], result)
+		}
+	}
+	if len(byIndex) == 0 {
+		return
+	}
+
+	indexNames := make([]string, 0, len(byIndex))
+	for indexName := range byIndex {
+		indexNames = append(indexNames, indexName)
+	}
+	sort.Strings(indexNames)
+
+	fmt.Println("By index:")
+	for _, indexName := range indexNames {
+		indexResults := byIndex[indexName]
+		latencies := successLatencies(indexResults)
+		failed := len(indexResults) - len(latencies)
+		stats, ok := computeLatencyStats(latencies)
+		if !ok {
+			fmt.Printf("  %s: %d succeeded, %d failed, latency n/a\n", indexName, len(latencies), failed)
+			continue
+		}
+		fmt.Printf("  %s: %d succeeded, %d failed, mean %v, p95 %v\n", indexName, len(latencies), failed, stats.Mean, stats.P95)
+	}
+}
+
+// printThroughput prints the achieved queries per second over the wall-clock
+// time of the run, overall and counting only successful queries.
+func printThroughput(successCount, failureCount int64, elapsed time.Duration) {
+	if elapsed <= 0 {
+		return
+	}
+	seconds := elapsed.Seconds()
+	fmt.Printf("Throughput: %.1f queries/s, %.1f successful/s over %v\n",
+		float64(successCount+failureCount)/seconds, float64(successCount)/seconds, elapsed.Round(time.Millisecond))
+}
+
+// printBytes prints the total and mean per query of the query payloads sent
+// and the response bodies received. Skipped queries are left out.
+func printBytes(results []QueryResult) {
+	var sent, received int64
+	queries := 0
+	for _, result := range results {
+		if !result.Skipped {
+			sent += result.BytesSent
+			received += result.BytesReceived
+			queries++
+		}
+	}
+	if queries == 0 {
+		return
+	}
+	fmt.Printf("Bytes received: total %s, mean %s per query\n", formatBytes(received), formatBytes(received/int64(queries)))
+	fmt.Printf("Bytes sent: total %s, mean %s per query\n", formatBytes(sent), formatBytes(sent/int64(queries)))
+}
+
+// printSlowest prints the n queries that took longest, slowest first, with
+// their index, latency, outcome and text. Skipped queries are left out.
+func printSlowest(results []QueryResult, n int) {
+	sent := make([]QueryResult, 0, len(results))
+	for _, result := range results {
+		if !result.Skipped {
+			sent = append(sent, result)
+		}
+	}
+	if len(sent) == 0 {
+		return
+	}
+	sort.SliceStable(sent, func(i, j int) bool { return sent[i].Latency > sent[j].Latency })
+	if n > len(sent) {
+		n = len(sent)
+	}
+
+	fmt.Printf("Slowest %d queries:\n", n)
+	for _, result := range sent[:n] {
+		status := "success"
+		if result.Error != nil {
+			status = "failure (" + errorCategory(result.Error) + ")"
+		}
+		fmt.Printf("  query %d (%s): %v, %s\n    %s\n", result.QueryIndex, result.Type, result.Latency, status, result.Query)
+	}
+}
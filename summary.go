@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runSummary is the machine-readable rollup of a run written by
+// -summary-file, for CI systems to assert on.
+type runSummary struct {
+	// Region is the -region label of the run, if set.
+	Region          string  `json:"region,omitempty"`
+	Total           int64   `json:"total"`
+	Success         int64   `json:"success"`
+	Failure         int64   `json:"failure"`
+	Skipped         int     `json:"skipped"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	RPS             float64 `json:"rps"`
+	SuccessRPS      float64 `json:"success_rps"`
+	BytesSent       int64   `json:"bytes_sent"`
+	BytesReceived   int64   `json:"bytes_received"`
+	// Latency, TTFB and Took are omitted when no query succeeded.
+	Latency *latencySummary `json:"latency_ms,omitempty"`
+	TTFB    *latencySummary `json:"ttfb_ms,omitempty"`
+	Took    *latencySummary `json:"took_ms,omitempty"`
+	// StatusCounts counts queries by HTTP status, or by failure category
+	// for failures that got no response.
+	StatusCounts map[string]int `json:"status_counts"`
+	// FailureCategories counts failed queries the way the printed failure
+	// summary does.
+	FailureCategories map[string]int `json:"failure_categories"`
+	// Buckets breaks the run down into intervals of BucketSeconds by when
+	// each query completed.
+	BucketSeconds float64      `json:"bucket_seconds,omitempty"`
+	Buckets       []timeBucket `json:"buckets,omitempty"`
+}
+
+// latencySummary is latencyStats in milliseconds.
+type latencySummary struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+}
+
+func newLatencySummary(sorted []time.Duration) *latencySummary {
+	stats, ok := computeLatencyStats(sorted)
+	if !ok {
+		return nil
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return &latencySummary{
+		Min:  ms(stats.Min),
+		Mean: ms(stats.Mean),
+		Max:  ms(stats.Max),
+		P50:  ms(stats.P50),
+		P95:  ms(stats.P95),
+		P99:  ms(stats.P99),
+	}
+}
+
+// summarizeRun builds the rollup of results from a run that took elapsed.
+func summarizeRun(successCount, failureCount int64, results []QueryResult, elapsed time.Duration) runSummary {
+	summary := runSummary{
+		Total:             successCount + failureCount,
+		Success:           successCount,
+		Failure:           failureCount,
+		DurationSeconds:   elapsed.Seconds(),
+		Latency:           newLatencySummary(successLatencies(results)),
+		TTFB:              newLatencySummary(successTTFBs(results)),
+		Took:              newLatencySummary(successTooks(results)),
+		StatusCounts:      make(map[string]int),
+		FailureCategories: make(map[string]int),
+	}
+	if elapsed > 0 {
+		summary.RPS = float64(summary.Total) / elapsed.Seconds()
+		summary.SuccessRPS = float64(successCount) / elapsed.Seconds()
+	}
+
+	for _, result := range results {
+		summary.BytesSent += result.BytesSent
+		summary.BytesReceived += result.BytesReceived
+		if result.Skipped {
+			summary.Skipped++
+			continue
+		}
+		summary.StatusCounts[statusLabel(result.Error)]++
+		if result.Error != nil {
+			summary.FailureCategories[errorCategory(result.Error)]++
+		}
+	}
+	return summary
+}
+
+// writeSummary writes summary to path as indented JSON.
+func writeSummary(path string, summary runSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize summary: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write summary file: %v", err)
+	}
+	return nil
+}
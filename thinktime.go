@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// thinkTime is how long each worker pauses between finishing one query and
+// starting its next, to model a user reading results rather than a flood of
+// back-to-back requests. The pause is drawn uniformly from Min to Max; the
+// zero value does not pause.
+type thinkTime struct {
+	Min, Max time.Duration
+}
+
+// parseThinkTime parses a duration such as "200ms" or a range such as
+// "100ms-500ms".
+func parseThinkTime(spec string) (thinkTime, error) {
+	low, high, isRange := strings.Cut(spec, "-")
+	if !isRange {
+		high = low
+	}
+	minValue, err := time.ParseDuration(strings.TrimSpace(low))
+	if err != nil {
+		return thinkTime{}, err
+	}
+	maxValue, err := time.ParseDuration(strings.TrimSpace(high))
+	if err != nil {
+		return thinkTime{}, err
+	}
+	if minValue < 0 {
+		return thinkTime{}, errors.New("think time must not be negative")
+	}
+	if minValue > maxValue {
+		return thinkTime{}, fmt.Errorf("minimum of %q is above its maximum", spec)
+	}
+	return thinkTime{Min: minValue, Max: maxValue}, nil
+}
+
+// pause waits for the next think time, returning false early if ctx is
+// cancelled.
+func (t thinkTime) pause(ctx context.Context) bool {
+	if t.Max <= 0 {
+		return true
+	}
+	return sleepContext(ctx, t.Min+time.Duration(rand.Int63n(int64(t.Max-t.Min)+1)))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures TLS for endpoints that require mutual TLS or are
+// signed by a private CA.
+type TLSOptions struct {
+	// ClientCert and ClientKey are PEM files holding the client certificate
+	// presented to the server. Both or neither must be set.
+	ClientCert string
+	ClientKey  string
+	// CACert is a PEM bundle of CAs trusted for the server certificate,
+	// replacing the system roots. Empty means the system roots.
+	CACert string
+	// Insecure skips verification of the server certificate.
+	Insecure bool
+}
+
+// config builds the tls.Config described by o, or returns nil if o leaves
+// the default TLS behaviour unchanged.
+func (o TLSOptions) config() (*tls.Config, error) {
+	if o.ClientCert == "" && o.ClientKey == "" && o.CACert == "" && !o.Insecure {
+		return nil, nil
+	}
+	if (o.ClientCert == "") != (o.ClientKey == "") {
+		return nil, errors.New("client certificate and client key must be given together")
+	}
+
+	config := &tls.Config{InsecureSkipVerify: o.Insecure}
+	if o.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s and key %s: %w", o.ClientCert, o.ClientKey, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if o.CACert != "" {
+		pem, err := os.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", o.CACert)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
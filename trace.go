@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// connTiming breaks down how a request got its connection, recorded with
+// -trace-timing. The phases are zero when the connection was reused.
+type connTiming struct {
+	DNS     time.Duration `json:",omitempty"`
+	Connect time.Duration `json:",omitempty"`
+	TLS     time.Duration `json:",omitempty"`
+	Reused  bool
+}
+
+// requestTrace collects what the httptrace hooks report for one request.
+// Dialing can outlive the request, so its hooks may fire late and
+// concurrently; mu guards the timing.
+type requestTrace struct {
+	start time.Time
+	info  *responseInfo
+
+	mu                               sync.Mutex
+	timing                           connTiming
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+// traceRequest returns req with an httptrace.ClientTrace that records the
+// time to first byte of its response into info, measured from when it is
+// called. If detailed, the trace also times the connection phases, which
+// finish stores in info. Call it just before sending req.
+func traceRequest(req *http.Request, info *responseInfo, detailed bool) (*http.Request, *requestTrace) {
+	t := &requestTrace{start: time.Now(), info: info}
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { info.TTFB = time.Since(t.start) },
+	}
+	if detailed {
+		trace.DNSStart = func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) }
+		trace.DNSDone = func(httptrace.DNSDoneInfo) { t.since(t.dnsStart, &t.timing.DNS) }
+		trace.ConnectStart = func(string, string) { t.mark(&t.connectStart) }
+		trace.ConnectDone = func(string, string, error) { t.since(t.connectStart, &t.timing.Connect) }
+		trace.TLSHandshakeStart = func() { t.mark(&t.tlsStart) }
+		trace.TLSHandshakeDone = func(tls.ConnectionState, error) { t.since(t.tlsStart, &t.timing.TLS) }
+		trace.GotConn = func(conn httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.timing.Reused = conn.Reused
+			t.mu.Unlock()
+		}
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), t
+}
+
+func (t *requestTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *requestTrace) since(start time.Time, phase *time.Duration) {
+	t.mu.Lock()
+	*phase = time.Since(start)
+	t.mu.Unlock()
+}
+
+// finish records the connection timing into info, once the request is done.
+func (t *requestTrace) finish() {
+	t.mu.Lock()
+	timing := t.timing
+	t.mu.Unlock()
+	t.info.Timing = &timing
+}
+
+// printConnTiming prints how many queries opened a connection and how many
+// reused one, and the DNS, connect and TLS times of the new connections, for
+// results recorded with -trace-timing. Skipped queries are left out.
+func printConnTiming(results []QueryResult) {
+	var (
+		reused, opened           int
+		dns, connect, handshakes []time.Duration
+	)
+	for _, result := range results {
+		if result.Skipped || result.Timing == nil {
+			continue
+		}
+		if result.Timing.Reused {
+			reused++
+			continue
+		}
+		opened++
+		if result.Timing.DNS > 0 {
+			dns = append(dns, result.Timing.DNS)
+		}
+		if result.Timing.Connect > 0 {
+			connect = append(connect, result.Timing.Connect)
+		}
+		if result.Timing.TLS > 0 {
+			handshakes = append(handshakes, result.Timing.TLS)
+		}
+	}
+	if reused+opened == 0 {
+		return
+	}
+
+	fmt.Printf("Connections: %d new, %d reused (%.1f%% reused)\n", opened, reused, 100*float64(reused)/float64(reused+opened))
+	for _, phase := range []struct {
+		label  string
+		phases []time.Duration
+	}{{"DNS", dns}, {"Connect", connect}, {"TLS handshake", handshakes}} {
+		sort.Slice(phase.phases, func(i, j int) bool { return phase.phases[i] < phase.phases[j] })
+		if stats, ok := computeLatencyStats(phase.phases); ok {
+			fmt.Printf("  %s: %d times, mean %v, p95 %v, max %v\n", phase.label, stats.Count, stats.Mean, stats.P95, stats.Max)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resultTransform reshapes a SearchResult before it is stored. It maps each
+// output key to a JSON Pointer (RFC 6901) into the result, for example
+// {"hits": "/total_hits", "top_id": "/hits/0/id"}.
+type resultTransform map[string]string
+
+// sampleSearchResult is the response shape transforms are validated against.
+var sampleSearchResult = SearchResult{
+	Status:   map[string]interface{}{"total": 1, "failed": 0, "successful": 1},
+	Total:    1,
+	Hits:     []SearchHit{{Index: "index", ID: "id", Score: 1, Fields: json.RawMessage(`{}`)}},
+	Took:     1,
+	MaxScore: 1,
+}
+
+// loadTransform reads a transform from path and checks every pointer against
+// a sample response, so a typo is reported at startup rather than as a
+// results file full of nulls.
+func loadTransform(path string) (resultTransform, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var transform resultTransform
+	if err := json.Unmarshal(data, &transform); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %v", path, err)
+	}
+	if len(transform) == 0 {
+		return nil, fmt.Errorf("%s maps no fields", path)
+	}
+
+	sample, err := toGeneric(&sampleSearchResult)
+	if err != nil {
+		return nil, err
+	}
+	for key, pointer := range transform {
+		tokens, err := parsePointer(pointer)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		if !pointerFitsSample(sample, tokens) {
+			return nil, fmt.Errorf("%s: %s does not match the search response structure", key, pointer)
+		}
+	}
+	return transform, nil
+}
+
+// apply returns the transformed form of result. Pointers that do not resolve
+// in this particular result, such as a hit index past the end, map to null.
+func (t resultTransform) apply(result *SearchResult) (map[string]interface{}, error) {
+	doc, err := toGeneric(result)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]interface{}, len(t))
+	for key, pointer := range t {
+		tokens, _ := parsePointer(pointer)
+		value, _ := resolvePointer(doc, tokens)
+		out[key] = value
+	}
+	return out, nil
+}
+
+// toGeneric converts v to the maps and slices encoding/json decodes into.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func resolvePointer(doc interface{}, tokens []string) (interface{}, bool) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// pointerFitsSample reports whether tokens could resolve in a real response,
+// judged against sample. Any array index is accepted, and anything below a
+// hit's stored fields is accepted, since their content depends on the index.
+func pointerFitsSample(sample interface{}, tokens []string) bool {
+	for i, token := range tokens {
+		switch node := sample.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return false
+			}
+			if token == "fields" && i > 0 {
+				return true
+			}
+			sample = value
+		case []interface{}:
+			if _, err := strconv.Atoi(token); err != nil || len(node) == 0 {
+				return false
+			}
+			sample = node[0]
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// validateQuery checks a query loaded from a queries file before any is sent,
+// so a hand-edited file fails with the offending query rather than with
+// thousands of 400s. Every query needs a non-empty "query" object; strict
+// also checks the fields required by the query shapes FTS knows, recursing
+// into compound queries.
+func validateQuery(query Query, strict bool) error {
+	if len(query.Query) == 0 {
+		return errors.New(`missing or empty "query" object`)
+	}
+	if strict {
+		return validateShape(query.Query)
+	}
+	return nil
+}
+
+// validateShape checks the fields of one FTS query object by its shape.
+// Shapes it does not recognize are accepted as they are.
+func validateShape(query map[string]interface{}) error {
+	for _, compound := range []string{"conjuncts", "disjuncts"} {
+		if value, ok := query[compound]; ok {
+			children, ok := value.([]interface{})
+			if !ok || len(children) == 0 {
+				return fmt.Errorf("%q must be a non-empty array of queries", compound)
+			}
+			for i, child := range children {
+				if err := validateChild(child); err != nil {
+					return fmt.Errorf("%s[%d]: %w", compound, i, err)
+				}
+			}
+			return nil
+		}
+	}
+
+	switch queryType(query) {
+	case typeBoolean:
+		for _, clause := range []string{"must", "should", "must_not"} {
+			if value, ok := query[clause]; ok {
+				if err := validateChild(value); err != nil {
+					return fmt.Errorf("%s: %w", clause, err)
+				}
+			}
+		}
+		return nil
+	case typeLocation:
+		if _, ok := query["distance"].(string); !ok {
+			return errors.New(`geo distance query needs a "distance" such as "100mi"`)
+		}
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("geo distance query %w", err)
+		}
+	case typeBoundingBox:
+		for _, corner := range []string{"top_left", "bottom_right"} {
+			if query[corner] == nil {
+				return fmt.Errorf("geo bounding box query needs a %q corner", corner)
+			}
+		}
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("geo bounding box query %w", err)
+		}
+	case typePolygon:
+		if points, ok := query["polygon_points"].([]interface{}); !ok || len(points) < 3 {
+			return errors.New(`geo polygon query needs at least 3 "polygon_points"`)
+		}
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("geo polygon query %w", err)
+		}
+	case typeRelationship:
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("match query %w", err)
+		}
+	case typeMatchPhrase:
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("match_phrase query %w", err)
+		}
+	case typeNumericRange:
+		for _, bound := range []string{"min", "max"} {
+			if value, ok := query[bound]; ok {
+				if _, ok := value.(float64); !ok {
+					return fmt.Errorf("numeric range %q must be a number", bound)
+				}
+			}
+		}
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("numeric range query %w", err)
+		}
+	case typeDateRange:
+		for _, bound := range []string{"start", "end"} {
+			if value, ok := query[bound]; ok {
+				if _, ok := value.(string); !ok {
+					return fmt.Errorf("date range %q must be a string", bound)
+				}
+			}
+		}
+		if err := requireField(query); err != nil {
+			return fmt.Errorf("date range query %w", err)
+		}
+	}
+	return nil
+}
+
+// validateChild checks a query nested inside a compound query.
+func validateChild(child interface{}) error {
+	query, ok := child.(map[string]interface{})
+	if !ok || len(query) == 0 {
+		return errors.New("want a non-empty query object")
+	}
+	return validateShape(query)
+}
+
+func requireField(query map[string]interface{}) error {
+	if field, _ := query["field"].(string); field == "" {
+		return errors.New(`needs a "field"`)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// redactedHeaders are replaced in request dumps so secrets do not leak into
+// logs.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+// logRequest dumps a request about to be sent at debug level.
+func logRequest(req *http.Request, body []byte) {
+	header := req.Header.Clone()
+	for _, name := range redactedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "REDACTED")
+		}
+	}
+	slog.Debug("sending request", "method", req.Method, "url", req.URL.Redacted(), "headers", header, "body", string(body))
+}
+
+// logResponse dumps a response received for the request to url at debug
+// level.
+func logResponse(url string, resp *http.Response, body []byte) {
+	slog.Debug("received response", "url", url, "status", resp.StatusCode, "headers", resp.Header, "body", string(body))
+}
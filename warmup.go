@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Warmup runs n queries, taken from the start of queries and cycling through
+// them if there are fewer, so that server caches are warm before measuring.
+// Their results are discarded: they are not passed to OnResult, counted by
+// Completed or recorded in the metrics. It prints how long the warmup took.
+func (bs *BatchSearcher) Warmup(ctx context.Context, indexNames []string, queries []BatchQuery, n, batchSize int) {
+	if n <= 0 || len(queries) == 0 {
+		return
+	}
+	warmup := make([]BatchQuery, 0, n)
+	for len(warmup) < n {
+		warmup = append(warmup, queries[len(warmup)%len(queries)])
+	}
+
+	start := time.Now()
+	success, failure, _ := bs.runStream(ctx, indexNames, queryChannel(ctx, warmup), batchSize, false)
+	fmt.Printf("Warmup: %d queries in %v (%d failed)\n", success+failure, time.Since(start).Round(time.Millisecond), failure)
+}